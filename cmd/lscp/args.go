@@ -13,8 +13,10 @@ import (
 	"github.com/blacknon/lssh/check"
 	"github.com/blacknon/lssh/common"
 	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/history"
 	"github.com/blacknon/lssh/list"
 	"github.com/blacknon/lssh/scp"
+	sshcmd "github.com/blacknon/lssh/ssh"
 	"github.com/urfave/cli"
 )
 
@@ -64,10 +66,14 @@ USAGE:
 	// TODO(blacknon): オプションの追加(0.7.0)
 	//     -P <num> ... 同じホストでパラレルでファイルをコピーできるようにする。パラレル数を指定。
 	app.Flags = []cli.Flag{
-		cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames"},
+		cli.StringSliceFlag{Name: "host,H", Usage: "connect servernames. @group is expanded to the member servers of group or tag. glob (web*) and /regex/ are expanded to the matched servers."},
+		cli.StringFlag{Name: "select", Usage: "connect the servers matched with filter expression (fuzzy match, same as the list view). ex.) --select 'web prod'"},
+		cli.StringSliceFlag{Name: "exclude,x", Usage: "exclude servername (or @group, glob, /regex/) from the selected servers."},
+		cli.BoolFlag{Name: "confirm", Usage: "ask whether to continue before connecting to the selected servers."},
 		cli.BoolFlag{Name: "list,l", Usage: "print server list from config"},
 		cli.StringFlag{Name: "file,F", Value: defConf, Usage: "config file path"},
 		cli.BoolFlag{Name: "permission,p", Usage: "copy file permission"},
+		cli.BoolFlag{Name: "refresh", Usage: "refresh the cache of dynamic host sources ([dynamic])"},
 		cli.BoolFlag{Name: "help,h", Usage: "print this help"},
 	}
 	app.EnableBashCompletion = true
@@ -109,15 +115,40 @@ USAGE:
 		isToRemote, _ := check.ParseScpPath(toArg)
 
 		// Check from and to Type
-		check.CheckTypeError(isFromInRemote, isFromInLocal, isToRemote, len(hosts))
+		countHosts := len(hosts)
+		if c.String("select") != "" {
+			countHosts++
+		}
+		check.CheckTypeError(isFromInRemote, isFromInLocal, isToRemote, countHosts)
 
 		// Get config data
+		conf.RefreshDynamic = c.Bool("refresh")
 		data := conf.Read(confpath)
 
 		// Get Server Name List (and sort List)
 		names := conf.GetNameList(data)
 		sort.Strings(names)
 
+		// select servers by hosts (@group, pattern), filter expression and excludes
+		hosts, names, isFiltered, err := list.SelectHosts(data, names, hosts, c.String("select"), c.StringSlice("exclude"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		// show the selected servers before running
+		if len(hosts) > 0 && (isFiltered || c.Bool("confirm")) {
+			ok, err := list.ConfirmHosts(hosts, c.Bool("confirm"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			if !ok {
+				fmt.Fprintln(os.Stderr, "Canceled.")
+				os.Exit(1)
+			}
+		}
+
 		selected := []string{}
 		toServer := []string{}
 		fromServer := []string{}
@@ -138,6 +169,9 @@ USAGE:
 			// View From list
 			from_l := new(list.ListInfo)
 			from_l.Prompt = "lscp(from)>>"
+			from_l.Fuzzy = true
+			from_l.ProxyRouteFunc = sshcmd.GetProxyRouteText
+			from_l.History, _ = history.Load()
 			from_l.NameList = names
 			from_l.DataList = data
 			from_l.MultiFlag = false
@@ -157,6 +191,9 @@ USAGE:
 			// View to list
 			to_l := new(list.ListInfo)
 			to_l.Prompt = "lscp(to)>>"
+			to_l.Fuzzy = true
+			to_l.ProxyRouteFunc = sshcmd.GetProxyRouteText
+			to_l.History, _ = history.Load()
 			to_l.NameList = names
 			to_l.DataList = data
 			to_l.MultiFlag = true
@@ -176,6 +213,9 @@ USAGE:
 			// View List And Get Select Line
 			l := new(list.ListInfo)
 			l.Prompt = "lscp>>"
+			l.Fuzzy = true
+			l.ProxyRouteFunc = sshcmd.GetProxyRouteText
+			l.History, _ = history.Load()
 			l.NameList = names
 			l.DataList = data
 			l.MultiFlag = true
@@ -9,10 +9,13 @@ import (
 	"os"
 	"sort"
 
+	"github.com/blacknon/lssh/check"
 	"github.com/blacknon/lssh/common"
 	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/history"
 	"github.com/blacknon/lssh/list"
 	"github.com/blacknon/lssh/sftp"
+	sshcmd "github.com/blacknon/lssh/ssh"
 	"github.com/urfave/cli"
 )
 
@@ -43,6 +46,9 @@ VERSION:
 USAGE:
     # start lsftp shell
     {{.Name}}
+
+    # start lsftp shell with the servers of group
+    {{.Name}} -H @group
 `
 	// Create app
 	app = cli.NewApp()
@@ -53,7 +59,12 @@ USAGE:
 	app.Version = "0.6.13"
 
 	app.Flags = []cli.Flag{
+		cli.StringSliceFlag{Name: "host,H", Usage: "connect `servername`. @group is expanded to the member servers of group or tag. glob (web*) and /regex/ are expanded to the matched servers."},
+		cli.StringFlag{Name: "select", Usage: "connect the servers matched with filter `expression` (fuzzy match, same as the list view). ex.) --select 'web prod'"},
+		cli.StringSliceFlag{Name: "exclude,x", Usage: "exclude `servername` (or @group, glob, /regex/) from the selected servers."},
+		cli.BoolFlag{Name: "confirm", Usage: "ask whether to continue before connecting to the selected servers."},
 		cli.StringFlag{Name: "file,F", Value: defConf, Usage: "config file path"},
+		cli.BoolFlag{Name: "refresh", Usage: "refresh the cache of dynamic host sources ([dynamic])"},
 		cli.BoolFlag{Name: "help,h", Usage: "print this help"},
 	}
 
@@ -67,26 +78,59 @@ USAGE:
 			os.Exit(0)
 		}
 
-		// hosts := c.StringSlice("host")
+		hosts := c.StringSlice("host")
 		confpath := c.String("file")
 
 		// Get config data
+		conf.RefreshDynamic = c.Bool("refresh")
 		data := conf.Read(confpath)
 
 		// Get Server Name List (and sort List)
 		names := conf.GetNameList(data)
 		sort.Strings(names)
 
-		// create select list
-		l := new(list.ListInfo)
-		l.Prompt = "lsftp>>"
-		l.NameList = names
-		l.DataList = data
-		l.MultiFlag = true
-		l.View()
+		// select servers by hosts (@group, pattern), filter expression and excludes
+		hosts, names, isFiltered, err := list.SelectHosts(data, names, hosts, c.String("select"), c.StringSlice("exclude"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
+		// show the selected servers before running
+		if len(hosts) > 0 && (isFiltered || c.Bool("confirm")) {
+			ok, err := list.ConfirmHosts(hosts, c.Bool("confirm"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			if !ok {
+				fmt.Fprintln(os.Stderr, "Canceled.")
+				os.Exit(1)
+			}
+		}
 
-		// selected check
-		selected := l.SelectName
+		selected := []string{}
+		if len(hosts) > 0 {
+			if !check.ExistServer(hosts, names) {
+				fmt.Fprintln(os.Stderr, "Input Server not found from list.")
+				os.Exit(1)
+			}
+			selected = hosts
+		} else {
+			// create select list
+			l := new(list.ListInfo)
+			l.Prompt = "lsftp>>"
+			l.Fuzzy = true
+			l.ProxyRouteFunc = sshcmd.GetProxyRouteText
+			l.History, _ = history.Load()
+			l.NameList = names
+			l.DataList = data
+			l.MultiFlag = true
+			l.View()
+
+			// selected check
+			selected = l.SelectName
+		}
 
 		// Check selected
 		if len(selected) == 0 {
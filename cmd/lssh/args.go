@@ -13,6 +13,7 @@ import (
 	"github.com/blacknon/lssh/check"
 	"github.com/blacknon/lssh/common"
 	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/history"
 	"github.com/blacknon/lssh/list"
 	sshcmd "github.com/blacknon/lssh/ssh"
 	"github.com/urfave/cli"
@@ -51,6 +52,12 @@ USAGE:
 
     # run command parallel in selected server over ssh.
     {{.Name}} -p command...
+
+    # run parallel-shell(pshell) in selected server over ssh.
+    {{.Name}} -s
+
+    # manage the encrypted credential vault. (init|set|get|rm|list)
+    {{.Name}} vault set prod/db01
 `
 
 	// Create app
@@ -64,12 +71,6 @@ USAGE:
 	// TODO(blacknon): オプションの追加
 	//     -T       ... マウント・リバースマウントのTypeを指定できるようにする(v0.7.0)
 	//                  ※ そもそもfuseをそのままfusemountでマウントできるのか？という謎もある
-	//     -f       ... バックグラウンドでの接続(X11接続やport forwardingをバックグラウンドで実行する場合など)。
-	//                  「ssh -f」と同じ。 (v0.7.0)
-	//                  (https://github.com/sevlyar/go-daemon)
-	//     -a       ... 自動接続モード(接続が切れてしまった場合、自動的に再接続を試みる)。autossh的なoptionとして追加。  (v0.7.0)
-	//     --autoconnect <num>
-	//              ... 自動接続モード(接続が切れてしまった場合、自動的に再接続を試みる)。再試行の回数指定(デフォルトは3回?)。  (v0.7.0)
 	//     --read_profile
 	//              ... デフォルトではlocalrc読み込みでのshellではsshサーバ上のprofileは読み込まないが、このオプションを指定することで読み込まれるようになる (v0.7.0)
 	//     -P
@@ -78,7 +79,10 @@ USAGE:
 	// Set options
 	app.Flags = []cli.Flag{
 		// common option
-		cli.StringSliceFlag{Name: "host,H", Usage: "connect `servername`."},
+		cli.StringSliceFlag{Name: "host,H", Usage: "connect `servername`. @group is expanded to the member servers of group or tag. glob (web*) and /regex/ are expanded to the matched servers."},
+		cli.StringFlag{Name: "select", Usage: "connect the servers matched with filter `expression` (fuzzy match, same as the list view). ex.) --select 'web prod'"},
+		cli.StringSliceFlag{Name: "exclude,x", Usage: "exclude `servername` (or @group, glob, /regex/) from the selected servers."},
+		cli.BoolFlag{Name: "confirm", Usage: "ask whether to continue before connecting to the selected servers."},
 		cli.StringFlag{Name: "file,F", Value: defConf, Usage: "config `filepath`."},
 
 		// port forward (with dynamic forward) option
@@ -90,33 +94,69 @@ USAGE:
 		cli.StringFlag{Name: "M", Usage: "NFS Dynamic forward mode. Specify a `port:/path/to/remote`. Only single connection works."},
 		cli.StringFlag{Name: "m", Usage: "NFS Reverse Dynamic forward mode. Specify a `port:/path/to/local`. Only single connection works."},
 
+		// command option
+		cli.StringFlag{Name: "output-dir", Usage: "write stdout, stderr and exit status of each server to `dir`/<server>.{out,err,rc} in command execution mode."},
+		cli.IntFlag{Name: "forks", Usage: "max `num` of servers connecting and running at the same time in command execution mode. 0 is unlimited."},
+		cli.StringFlag{Name: "output", Value: "text", Usage: "output `format` of command execution mode. text|json (JSON Lines)."},
+		cli.BoolFlag{Name: "aggregate", Usage: "group the servers with identical output and print it once (like dshbak -c) in command execution mode."},
+		cli.BoolFlag{Name: "diff", Usage: "with --aggregate, print the output of each group as diff against the majority output."},
+		cli.StringFlag{Name: "exit-policy", Value: "any", Usage: "exit non-zero when `any|all|majority` of servers failed in command execution mode."},
+
 		// Other bool
 		cli.BoolFlag{Name: "w", Usage: "Displays the server header when in command execution mode."},
 		cli.BoolFlag{Name: "W", Usage: "Not displays the server header when in command execution mode."},
 		cli.BoolFlag{Name: "not-execute,N", Usage: "not execute remote command and shell."},
+		cli.BoolFlag{Name: "f", Usage: "run in background after authentication. use with -N. works with a single server."},
+		cli.StringFlag{Name: "pidfile", Usage: "pid `file` of background mode(-f). default is ${XDG_RUNTIME_DIR}/lssh/<server>.pid."},
+		cli.BoolFlag{Name: "a", Usage: "auto reconnect mode. reconnect when the connection of shell or -N is lost (retry 3 times)."},
+		cli.IntFlag{Name: "autoconnect", Usage: "auto reconnect mode, with retry `num`. 0 is unlimited."},
 		cli.BoolFlag{Name: "X11,X", Usage: "Enable x11 forwarding(forward to ${DISPLAY})."},
 		cli.BoolFlag{Name: "Y", Usage: "Enable trusted x11 forwarding(forward to ${DISPLAY})."},
 		cli.BoolFlag{Name: "term,t", Usage: "run specified command at terminal."},
 		cli.BoolFlag{Name: "parallel,p", Usage: "run command parallel node(tail -F etc...)."},
+		cli.BoolFlag{Name: "pshell,s", Usage: "use parallel-shell(pshell). send input line to all selected servers."},
 		cli.BoolFlag{Name: "localrc", Usage: "use local bashrc shell."},
 		cli.BoolFlag{Name: "not-localrc", Usage: "not use local bashrc shell."},
 		cli.BoolFlag{Name: "list,l", Usage: "print server list from config."},
+		cli.BoolFlag{Name: "last", Usage: "connect to the servers of the last run (from the connection history)."},
+		cli.BoolFlag{Name: "refresh", Usage: "refresh the cache of dynamic host sources ([dynamic])."},
+		cli.BoolFlag{Name: "check-config", Usage: "check the config file (with include files), and print the problems."},
+		cli.StringFlag{Name: "export", Usage: "export the servers (all, or specified by -H) in `format`. ssh_config|ansible-ini|ansible-yaml|json."},
+		cli.BoolFlag{Name: "export-secret", Usage: "with --export, include the secrets (pass, passphrase, PIN). secret commands (*_cmd) are run."},
 		cli.BoolFlag{Name: "help,h", Usage: "print this help"},
 	}
 	app.EnableBashCompletion = true
 	app.HideHelp = true
 
+	// Set subcommands. they are dispatched only at the first argument (see disableSubcommands).
+	app.Commands = subcommands()
+
 	// Run command action
 	app.Action = func(c *cli.Context) error {
 		// show help messages
 		if c.Bool("help") {
+			c.App.Commands = subcommands()
 			cli.ShowAppHelp(c)
 			os.Exit(0)
 		}
 
-		hosts := c.StringSlice("host")
+		hosts := common.GetUniqueSlice(c.StringSlice("host"))
 		confpath := c.String("file")
 
+		// Check background mode
+		if c.Bool("f") && !c.Bool("not-execute") {
+			fmt.Fprintln(os.Stderr, "Error: -f option requires -N.")
+			os.Exit(1)
+		}
+
+		// refresh the cache of dynamic host sources
+		conf.RefreshDynamic = c.Bool("refresh")
+
+		// Check config
+		if c.Bool("check-config") {
+			os.Exit(checkConfig(confpath))
+		}
+
 		// Get config data
 		data := conf.Read(confpath)
 
@@ -139,6 +179,28 @@ USAGE:
 			os.Exit(0)
 		}
 
+		// connect to the servers of the last run
+		if c.Bool("last") && len(hosts) == 0 && c.String("select") == "" {
+			h, err := history.Load()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+
+			hosts = h.LastRun()
+			if len(hosts) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: connection history is empty.")
+				os.Exit(1)
+			}
+		}
+
+		// select servers by hosts (@group, pattern), filter expression and excludes
+		hosts, names, isFiltered, err := list.SelectHosts(data, names, hosts, c.String("select"), c.StringSlice("exclude"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			os.Exit(1)
+		}
+
 		selected := []string{}
 		if len(hosts) > 0 {
 			if !check.ExistServer(hosts, names) {
@@ -147,10 +209,33 @@ USAGE:
 			} else {
 				selected = hosts
 			}
-		} else {
+		}
+
+		// Export config
+		if c.String("export") != "" {
+			os.Exit(exportConfig(data, c.String("export"), selected, c.Bool("export-secret")))
+		}
+
+		// show the selected servers before running
+		if len(selected) > 0 && (isFiltered || c.Bool("confirm")) {
+			ok, err := list.ConfirmHosts(selected, c.Bool("confirm"))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+				os.Exit(1)
+			}
+			if !ok {
+				fmt.Fprintln(os.Stderr, "Canceled.")
+				os.Exit(1)
+			}
+		}
+
+		if len(selected) == 0 {
 			// View List And Get Select Line
 			l := new(list.ListInfo)
 			l.Prompt = "lssh>>"
+			l.Fuzzy = true
+			l.ProxyRouteFunc = sshcmd.GetProxyRouteText
+			l.History, _ = history.Load()
 			l.NameList = names
 			l.DataList = data
 			l.MultiFlag = isMulti
@@ -185,6 +270,36 @@ USAGE:
 		// exec command
 		r.ExecCmd = c.Args()
 		r.IsParallel = c.Bool("parallel")
+		r.Forks = c.Int("forks")
+
+		// output format
+		switch c.String("output") {
+		case sshcmd.OUTPUT_FORMAT_TEXT, sshcmd.OUTPUT_FORMAT_JSON:
+			r.OutputFormat = c.String("output")
+		default:
+			fmt.Fprintf(os.Stderr, "Error: --output must be text or json.\n")
+			os.Exit(1)
+		}
+
+		// aggregate output. --diff implies --aggregate.
+		r.Aggregate = c.Bool("aggregate") || c.Bool("diff")
+		r.AggregateDiff = c.Bool("diff")
+		if r.Aggregate && r.OutputFormat == sshcmd.OUTPUT_FORMAT_JSON {
+			fmt.Fprintf(os.Stderr, "Error: --aggregate and --diff can not be used with --output json.\n")
+			os.Exit(1)
+		}
+
+		// output directory
+		r.OutputDir = c.String("output-dir")
+
+		// exit policy
+		switch c.String("exit-policy") {
+		case sshcmd.EXIT_POLICY_ANY, sshcmd.EXIT_POLICY_ALL, sshcmd.EXIT_POLICY_MAJORITY:
+			r.ExitPolicy = c.String("exit-policy")
+		default:
+			fmt.Fprintf(os.Stderr, "Error: --exit-policy must be any, all or majority.\n")
+			os.Exit(1)
+		}
 
 		// x11 forwarding
 		enableX11 := c.Bool("X11")
@@ -215,7 +330,6 @@ USAGE:
 		}
 
 		// Set port forwards
-		var err error
 		var forwards []*conf.PortForward
 
 		// Set local port forwarding
@@ -276,6 +390,20 @@ USAGE:
 		// is not execute
 		r.IsNone = c.Bool("not-execute")
 
+		// background mode
+		r.IsBackground = c.Bool("f")
+		r.PidFile = c.String("pidfile")
+
+		// auto reconnect
+		if c.Bool("a") {
+			r.AutoReconnect = true
+			r.AutoReconnectMax = sshcmd.DefaultAutoReconnectMax
+		}
+		if c.IsSet("autoconnect") {
+			r.AutoReconnect = true
+			r.AutoReconnectMax = c.Int("autoconnect")
+		}
+
 		// Local/Remote port forwarding port
 		r.PortForward = forwards
 
@@ -289,7 +417,66 @@ USAGE:
 		r.HTTPReverseDynamicPortForward = c.String("r")
 
 		r.Start()
+		os.Exit(r.ExitCode)
 		return nil
 	}
 	return app
 }
+
+// exportConfig print the servers in format, and return the exit code.
+// The warnings (settings that can not be exported) are printed to stderr.
+func exportConfig(data conf.Config, format string, servers []string, withSecret bool) int {
+	result, warnings, err := data.Export(format, servers, withSecret)
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return 1
+	}
+
+	os.Stdout.Write(result)
+	return 0
+}
+
+// checkConfig print the problems of config, and return the exit code.
+// If there is an error, it returns 1. Warnings only, it returns 0.
+func checkConfig(confpath string) (code int) {
+	problems := conf.CheckConfig(confpath)
+
+	errors, warnings := 0, 0
+	for _, p := range problems {
+		fmt.Fprintln(os.Stdout, p)
+		if p.Warning {
+			warnings++
+		} else {
+			errors++
+		}
+	}
+
+	fmt.Fprintf(os.Stdout, "%s: %d error(s), %d warning(s)\n", confpath, errors, warnings)
+
+	if errors > 0 {
+		code = 1
+	}
+
+	return
+}
+
+// subcommands return the subcommands of lssh.
+func subcommands() []cli.Command {
+	return []cli.Command{
+		vaultCommand(),
+	}
+}
+
+// disableSubcommands removes the subcommands of app, if args (os.Args) does not start with a subcommand name.
+// urfave/cli dispatches the subcommand at the first positional argument even after the global flags,
+// but `lssh -H host vault status` has to run `vault status` on the remote host.
+func disableSubcommands(app *cli.App, args []string) {
+	if len(args) > 1 && app.Command(args[1]) != nil {
+		return
+	}
+
+	app.Commands = nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestDisableSubcommands(t *testing.T) {
+	type TestData struct {
+		desc          string
+		args          []string
+		expectCommand bool
+		expectHosts   []string
+		expectArgs    []string
+	}
+	tds := []TestData{
+		{desc: "Subcommand", args: []string{"lssh", "vault", "list"}, expectCommand: true},
+		{desc: "Remote command after -H", args: []string{"lssh", "-H", "h", "vault", "status"}, expectHosts: []string{"h"}, expectArgs: []string{"vault", "status"}},
+		{desc: "Remote command after flag", args: []string{"lssh", "-p", "vault", "status"}, expectHosts: []string{}, expectArgs: []string{"vault", "status"}},
+		{desc: "No args", args: []string{"lssh"}, expectHosts: []string{}, expectArgs: []string{}},
+	}
+	for _, v := range tds {
+		app := Lssh()
+		disableSubcommands(app, v.args)
+		assert.Equal(t, v.expectCommand, app.Command("vault") != nil, v.desc)
+		if v.expectCommand {
+			continue
+		}
+
+		// the remote command is passed to the action
+		var hosts, args []string
+		app.Action = func(c *cli.Context) error {
+			hosts = c.StringSlice("host")
+			args = c.Args()
+			return nil
+		}
+		assert.NoError(t, app.Run(common.ParseArgs(app.Flags, v.args)), v.desc)
+		assert.Equal(t, v.expectHosts, hosts, v.desc)
+		assert.Equal(t, v.expectArgs, args, v.desc)
+	}
+}
@@ -12,6 +12,7 @@ import (
 
 func main() {
 	app := Lssh()
+	disableSubcommands(app, os.Args)
 	args := common.ParseArgs(app.Flags, os.Args)
 	app.Run(args)
 }
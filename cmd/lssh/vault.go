@@ -0,0 +1,164 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// vaultCommand return the `lssh vault` subcommand, that manage the credential vault.
+// The vault file is ${LSSH_VAULT} (default is ~/.lssh.vault).
+func vaultCommand() cli.Command {
+	return cli.Command{
+		Name:  "vault",
+		Usage: "manage the encrypted credential vault (${LSSH_VAULT}, default ~/.lssh.vault). referenced as `vault:<name>` in config.",
+		Subcommands: []cli.Command{
+			{Name: "init", Usage: "create the new vault with passphrase.", Action: vaultInit},
+			{Name: "set", Usage: "set the secret of name. the secret is entered from the terminal, or read from stdin.", ArgsUsage: "name", Action: vaultSet},
+			{Name: "get", Usage: "print the secret of name.", ArgsUsage: "name", Action: vaultGet},
+			{Name: "rm", Usage: "remove the secret of name.", ArgsUsage: "name", Action: vaultRemove},
+			{Name: "list", Usage: "print the names of secrets.", Action: vaultList},
+		},
+	}
+}
+
+// vaultInit create the new vault.
+func vaultInit(c *cli.Context) error {
+	path := conf.DefaultVaultPath()
+	if common.IsExist(path) {
+		vaultExit(fmt.Errorf("%s already exists", path))
+	}
+
+	passphrase, err := conf.ReadVaultInput("new vault passphrase:")
+	if err != nil {
+		vaultExit(err)
+	}
+
+	confirm, err := conf.ReadVaultInput("new vault passphrase (again):")
+	if err != nil {
+		vaultExit(err)
+	}
+
+	if passphrase != confirm {
+		vaultExit(fmt.Errorf("passphrases do not match"))
+	}
+
+	_, err = conf.InitVault(path, passphrase)
+	if err != nil {
+		vaultExit(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "vault %s is created.\n", path)
+	return nil
+}
+
+// vaultSet set the secret of name to the vault.
+// If stdin is not a terminal, the first line of stdin is used as the secret.
+func vaultSet(c *cli.Context) error {
+	name := getVaultName(c)
+
+	v, err := conf.UnlockVault()
+	if err != nil {
+		vaultExit(err)
+	}
+
+	var secret string
+	if terminal.IsTerminal(int(os.Stdin.Fd())) {
+		secret, err = conf.ReadVaultInput(fmt.Sprintf("secret of %s:", name))
+	} else {
+		secret, err = bufio.NewReader(os.Stdin).ReadString('\n')
+		if secret != "" {
+			err = nil
+		}
+		secret = strings.TrimRight(secret, "\r\n")
+	}
+	if err != nil {
+		vaultExit(err)
+	}
+
+	v.Set(name, secret)
+	err = v.Save()
+	if err != nil {
+		vaultExit(err)
+	}
+
+	return nil
+}
+
+// vaultGet print the secret of name.
+func vaultGet(c *cli.Context) error {
+	name := getVaultName(c)
+
+	v, err := conf.UnlockVault()
+	if err != nil {
+		vaultExit(err)
+	}
+
+	secret, ok := v.Get(name)
+	if !ok {
+		vaultExit(fmt.Errorf("%s is not found in vault", name))
+	}
+
+	fmt.Fprintln(os.Stdout, secret)
+	return nil
+}
+
+// vaultRemove remove the secret of name from the vault.
+func vaultRemove(c *cli.Context) error {
+	name := getVaultName(c)
+
+	v, err := conf.UnlockVault()
+	if err != nil {
+		vaultExit(err)
+	}
+
+	if !v.Remove(name) {
+		vaultExit(fmt.Errorf("%s is not found in vault", name))
+	}
+
+	err = v.Save()
+	if err != nil {
+		vaultExit(err)
+	}
+
+	return nil
+}
+
+// vaultList print the names of secrets in the vault.
+func vaultList(c *cli.Context) error {
+	v, err := conf.UnlockVault()
+	if err != nil {
+		vaultExit(err)
+	}
+
+	for _, name := range v.Names() {
+		fmt.Fprintln(os.Stdout, name)
+	}
+
+	return nil
+}
+
+// getVaultName return the secret name from args of vault subcommand.
+func getVaultName(c *cli.Context) string {
+	if len(c.Args()) != 1 || c.Args()[0] == "" {
+		vaultExit(fmt.Errorf("usage: lssh vault %s name", c.Command.Name))
+	}
+
+	return c.Args()[0]
+}
+
+// vaultExit print the error, and exit with 1.
+func vaultExit(err error) {
+	fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	os.Exit(1)
+}
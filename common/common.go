@@ -24,6 +24,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -154,9 +155,9 @@ func GetFullPath(path string) (fullPath string) {
 	fullPath, _ = filepath.Abs(fullPath)
 
 	// ファイルがシンボリックリンクかどうかを確認
+	// (ファイルが存在しない場合は、そのままのパスを返す)
 	info, err := os.Lstat(fullPath)
 	if err != nil {
-		fmt.Println("Error:", err)
 		return
 	}
 
@@ -469,6 +470,8 @@ parseloop:
 						isOptionArgs = true
 					case cli.StringFlag:
 						isOptionArgs = true
+					case cli.IntFlag:
+						isOptionArgs = true
 					}
 				}
 			}
@@ -482,6 +485,8 @@ parseloop:
 					isOptionArgs = true
 				case cli.StringFlag:
 					isOptionArgs = true
+				case cli.IntFlag:
+					isOptionArgs = true
 				}
 			}
 		}
@@ -489,6 +494,96 @@ parseloop:
 	return result
 }
 
+// CompressHostList return the compact host list string, like pdsh/dshbak.
+// Hosts that differ only in the last number are collapsed to a range.
+//
+//	ex.) [web01 web02 web03 web05 db02] => "web[01-03,05],db02"
+func CompressHostList(hosts []string) string {
+	type hostGroup struct {
+		prefix, suffix string
+		width          int
+		names          []string
+		nums           []int
+	}
+
+	reg := regexp.MustCompile(`^(.*?)([0-9]+)([^0-9]*)$`)
+
+	groups := []*hostGroup{}
+	groupMap := map[string]*hostGroup{}
+	for _, host := range hosts {
+		match := reg.FindStringSubmatch(host)
+		if match == nil {
+			groups = append(groups, &hostGroup{names: []string{host}})
+			continue
+		}
+
+		prefix, digits, suffix := match[1], match[2], match[3]
+		num, _ := strconv.Atoi(digits)
+
+		// numbers with leading zero are grouped by width
+		width := 0
+		if strings.HasPrefix(digits, "0") {
+			width = len(digits)
+		}
+
+		key := fmt.Sprintf("%s\x00%s\x00%d", prefix, suffix, width)
+		g, ok := groupMap[key]
+		if !ok {
+			g = &hostGroup{prefix: prefix, suffix: suffix, width: width}
+			groupMap[key] = g
+			groups = append(groups, g)
+		}
+		g.names = append(g.names, host)
+		g.nums = append(g.nums, num)
+	}
+
+	result := []string{}
+	for _, g := range groups {
+		if len(g.names) == 1 {
+			result = append(result, g.names[0])
+			continue
+		}
+
+		nums := GetUniqueInts(g.nums)
+		sort.Ints(nums)
+
+		format := func(n int) string { return fmt.Sprintf("%0*d", g.width, n) }
+
+		ranges := []string{}
+		for i := 0; i < len(nums); {
+			j := i
+			for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+				j++
+			}
+
+			if i == j {
+				ranges = append(ranges, format(nums[i]))
+			} else {
+				ranges = append(ranges, format(nums[i])+"-"+format(nums[j]))
+			}
+			i = j + 1
+		}
+
+		result = append(result, g.prefix+"["+strings.Join(ranges, ",")+"]"+g.suffix)
+	}
+
+	return strings.Join(result, ",")
+}
+
+// GetUniqueInts return the slice with duplicate values removed.
+func GetUniqueInts(data []int) (result []int) {
+	m := make(map[int]bool)
+
+	for _, ele := range data {
+		if !m[ele] {
+			m[ele] = true
+			result = append(result, ele)
+		}
+	}
+
+	return
+}
+
 // IsDirPath identifies is the directory from the PATH string.
 func IsDirPath(path string) (isDir bool) {
 	dir := filepath.Dir(path)
@@ -536,12 +631,24 @@ func GetDefaultConfigPath() (path string) {
 	homeConfigPath := filepath.Join(home, ".lssh.conf")
 	xdgConfigPath := filepath.Join(xdgConfigHome, "lssh", "lssh.conf")
 
-	if _, err := os.Stat(homeConfigPath); os.IsExist(err) {
-		return homeConfigPath
+	// TOML is preferred, then YAML.
+	paths := []string{
+		homeConfigPath,
+		filepath.Join(home, ".lssh.yaml"),
+		filepath.Join(home, ".lssh.yml"),
+	}
+	if xdgConfigHome != "" {
+		paths = append(paths,
+			xdgConfigPath,
+			filepath.Join(xdgConfigHome, "lssh", "lssh.yaml"),
+			filepath.Join(xdgConfigHome, "lssh", "lssh.yml"),
+		)
 	}
 
-	if _, err := os.Stat(xdgConfigPath); os.IsExist(err) {
-		return xdgConfigPath
+	for _, p := range paths {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
 	}
 
 	return homeConfigPath
@@ -148,3 +148,23 @@ func TestStringCompression(t *testing.T) {
 	}
 
 }
+
+func TestCompressHostList(t *testing.T) {
+	type TestData struct {
+		desc   string
+		hosts  []string
+		expect string
+	}
+	tds := []TestData{
+		{desc: "Single host", hosts: []string{"web01"}, expect: "web01"},
+		{desc: "Consecutive hosts are collapsed to a range", hosts: []string{"web01", "web02", "web03"}, expect: "web[01-03]"},
+		{desc: "Non-consecutive hosts", hosts: []string{"web03", "web01", "web02", "web05", "db02"}, expect: "web[01-03,05],db02"},
+		{desc: "Hosts with suffix", hosts: []string{"node1.example.com", "node2.example.com"}, expect: "node[1-2].example.com"},
+		{desc: "Hosts without number", hosts: []string{"localhost", "web1", "web2"}, expect: "localhost,web[1-2]"},
+		{desc: "Different width are not collapsed", hosts: []string{"web01", "web1"}, expect: "web01,web1"},
+	}
+	for _, v := range tds {
+		got := CompressHostList(v.hosts)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
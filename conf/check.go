@@ -0,0 +1,581 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of config check (`lssh --check-config`).
+// Unlike Read, it does not exit at the first error, and reports all problems with the file and key.
+
+package conf
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// ConfigProblem is a problem of config, found by CheckConfig.
+type ConfigProblem struct {
+	File    string
+	Key     string
+	Message string
+
+	// If Warning is true, the config can be used, but may not work as expected.
+	Warning bool
+}
+
+// String return the problem in `file: key: level: message` format.
+func (p ConfigProblem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+
+	if p.Key == "" {
+		return fmt.Sprintf("%s: %s: %s", p.File, level, p.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s: %s", p.File, p.Key, level, p.Message)
+}
+
+// configChecker is the state of CheckConfig.
+type configChecker struct {
+	problems []ConfigProblem
+
+	// file that defines the server, proxy or group. the later definition overwrites.
+	serverSources map[string]string
+	proxySources  map[string]string
+	groupSources  map[string]string
+}
+
+func (cc *configChecker) errorf(file, key, format string, a ...interface{}) {
+	cc.problems = append(cc.problems, ConfigProblem{File: file, Key: key, Message: fmt.Sprintf(format, a...)})
+}
+
+func (cc *configChecker) warnf(file, key, format string, a ...interface{}) {
+	cc.problems = append(cc.problems, ConfigProblem{File: file, Key: key, Message: fmt.Sprintf(format, a...), Warning: true})
+}
+
+// CheckConfig validate the whole merged config of confPath, and return the problems.
+// The order of merge is same as Read (config file, OpenSSH configs, Ansible inventories, dynamic host sources, include files).
+// Proxies, groups and sshconfig are merged in order of config file and include files.
+func CheckConfig(confPath string) []ConfigProblem {
+	cc := &configChecker{
+		serverSources: map[string]string{},
+		proxySources:  map[string]string{},
+		groupSources:  map[string]string{},
+	}
+
+	if !common.IsExist(confPath) {
+		cc.errorf(confPath, "", "config file is not found")
+		return cc.problems
+	}
+
+	// read config file
+	c, ok := cc.checkFile(confPath)
+	if !ok {
+		return cc.problems
+	}
+	if c.Server == nil {
+		c.Server = map[string]ServerConfig{}
+	}
+	if c.SSHConfig == nil {
+		c.SSHConfig = map[string]OpenSSHConfig{}
+	}
+	cc.addSources(confPath, c)
+
+	// include files
+	err := c.readIncludeSettings()
+	if err != nil {
+		cc.errorf(confPath, "include", "%s", err)
+		return cc.problems
+	}
+
+	sshConfigFiles := map[string]string{}
+	inventoryFiles := map[string]string{}
+	dynamicFiles := map[string]string{}
+	for key := range c.SSHConfig {
+		sshConfigFiles[key] = confPath
+	}
+	for key := range c.Inventory {
+		inventoryFiles[key] = confPath
+	}
+	for key := range c.Dynamic {
+		dynamicFiles[key] = confPath
+	}
+	for _, f := range c.includeFiles {
+		for key := range f.Config.SSHConfig {
+			sshConfigFiles[key] = f.Path
+		}
+		for key := range f.Config.Inventory {
+			inventoryFiles[key] = f.Path
+		}
+		for key := range f.Config.Dynamic {
+			dynamicFiles[key] = f.Path
+		}
+	}
+
+	// OpenSSH configs. If not set, ~/.ssh/config is read.
+	if len(c.SSHConfig) == 0 && common.IsExist(common.GetFullPath("~/.ssh/config")) {
+		servers, err := getOpenSSHConfig("~/.ssh/config", "")
+		if err != nil {
+			cc.errorf("~/.ssh/config", "", "read OpenSSH config error: %s", err)
+		}
+		cc.addServerSources("~/.ssh/config", servers)
+	}
+
+	sshConfigKeys := []string{}
+	for key := range c.SSHConfig {
+		sshConfigKeys = append(sshConfigKeys, key)
+	}
+	sort.Strings(sshConfigKeys)
+
+	for _, key := range sshConfigKeys {
+		sc := c.SSHConfig[key]
+		source := sc.Path
+		if source == "" {
+			source = "command:" + sc.Command
+		}
+
+		servers, err := getOpenSSHConfig(sc.Path, sc.Command)
+		if err != nil {
+			cc.errorf(sshConfigFiles[key], "sshconfig."+key, "read OpenSSH config error: %s", err)
+			continue
+		}
+		cc.addServerSources(source, servers)
+	}
+
+	// Ansible inventories
+	for _, name := range c.getInventoryNames() {
+		ic := c.Inventory[name]
+		if ic.Path == "" && ic.Command == "" {
+			cc.errorf(inventoryFiles[name], "inventory."+name, "path or command is not set")
+			continue
+		}
+
+		source := ic.Path
+		if source == "" {
+			source = "command:" + ic.Command
+		}
+
+		servers, _, err := getInventoryConfig(name, ic.Path, ic.Command)
+		if err != nil {
+			cc.errorf(inventoryFiles[name], "inventory."+name, "read Ansible inventory error: %s", err)
+			continue
+		}
+		cc.addServerSources(source, servers)
+	}
+
+	// dynamic host sources
+	for _, name := range c.getDynamicNames() {
+		servers, warning, err := getDynamicConfig(name, c.Dynamic[name])
+		if warning != "" {
+			cc.warnf(dynamicFiles[name], "dynamic."+name, "%s", warning)
+		}
+		if err != nil {
+			cc.errorf(dynamicFiles[name], "dynamic."+name, "%s", err)
+			continue
+		}
+		cc.addServerSources("dynamic."+name, servers)
+	}
+
+	for _, f := range c.includeFiles {
+		cc.checkFile(f.Path)
+		cc.addSources(f.Path, f.Config)
+	}
+
+	// merged config
+	c.ReduceCommon()
+	c.ReadOpenSSHConfig()
+	c.ReadInventory()
+	c.ReadDynamic()
+	c.ReadIncludeFiles()
+
+	cc.checkServers(c)
+	cc.checkProxies(c)
+	cc.checkGroups(c)
+	cc.checkList(confPath, c.List)
+
+	return cc.problems
+}
+
+// checkList check the columns and sort of [list].
+func (cc *configChecker) checkList(file string, l ListConfig) {
+	for _, column := range l.Columns {
+		if !common.Contains(ListColumns, column) {
+			cc.errorf(file, "list.columns", "unknown column '%s' (%s)", column, strings.Join(ListColumns, "|"))
+		}
+	}
+
+	names := []string{}
+	for name := range l.Widths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !common.Contains(ListColumns, name) {
+			cc.errorf(file, "list.widths."+name, "unknown column")
+		} else if l.Widths[name] < 0 {
+			cc.errorf(file, "list.widths."+name, "width must be 0 or more")
+		}
+	}
+
+	if l.Sort != "" && !common.Contains(ListSortKeys, l.Sort) {
+		cc.errorf(file, "list.sort", "unknown sort key '%s' (%s)", l.Sort, strings.Join(ListSortKeys, "|"))
+	}
+}
+
+// checkFile decode the file, and check unknown keys.
+func (cc *configChecker) checkFile(path string) (c Config, ok bool) {
+	path = common.GetFullPath(path)
+
+	err := decodeFile(path, &c)
+	if err != nil {
+		cc.errorf(path, "", "%s", err)
+		return c, false
+	}
+
+	raw := map[string]interface{}{}
+	if err := decodeFile(path, &raw); err == nil {
+		isYAML := isYAMLFile(path)
+		for _, key := range unknownKeys(raw, reflect.TypeOf(Config{}), "", isYAML) {
+			cc.errorf(path, key, "unknown key")
+		}
+	}
+
+	return c, true
+}
+
+// addSources record the servers, proxies and groups defined in file.
+func (cc *configChecker) addSources(file string, c Config) {
+	cc.addServerSources(file, c.Server)
+
+	names := []string{}
+	for name := range c.Proxy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if prev, ok := cc.proxySources[name]; ok {
+			cc.warnf(file, "proxy."+name, "proxy name is overwritten (previously defined in %s)", prev)
+		}
+		cc.proxySources[name] = file
+	}
+
+	names = []string{}
+	for name := range c.Group {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if prev, ok := cc.groupSources[name]; ok {
+			cc.warnf(file, "group."+name, "group name is overwritten (previously defined in %s)", prev)
+		}
+		cc.groupSources[name] = file
+	}
+}
+
+// addServerSources record the servers defined in file.
+// If the server name is already defined, it is reported as overwritten.
+func (cc *configChecker) addServerSources(file string, servers map[string]ServerConfig) {
+	names := []string{}
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if prev, ok := cc.serverSources[name]; ok {
+			cc.warnf(file, "server."+name, "server name is overwritten (previously defined in %s)", prev)
+		}
+		cc.serverSources[name] = file
+	}
+}
+
+// checkServers check the merged server configs.
+func (cc *configChecker) checkServers(c Config) {
+	names := GetNameList(c)
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := c.Server[name]
+		file := cc.serverSources[name]
+		key := "server." + name
+
+		// address, user, auth
+		if v.Addr == "" {
+			cc.errorf(file, key+".addr", "'addr' is not set")
+		}
+		if v.User == "" {
+			cc.errorf(file, key+".user", "'user' is not set")
+		}
+		if !checkFormatServerConfAuth(v) && v.KeyCommand == "" {
+			cc.errorf(file, key, "authentication information is not set")
+		}
+
+		// proxy
+		if v.ProxyCommand == "" || v.ProxyCommand == "none" {
+			cc.checkProxyReference(c, file, key, v.Proxy, v.ProxyType)
+		}
+		if _, err := getProxyChain(c, name); err != nil {
+			cc.errorf(file, key+".proxy", "%s", err)
+		}
+
+		// port forwards
+		for _, f := range v.PortForwards {
+			if _, err := ParsePortForward(f); err != nil {
+				cc.errorf(file, key+".port_forwards", "%s", err)
+			}
+		}
+		if (v.PortForwardLocal == "") != (v.PortForwardRemote == "") {
+			cc.warnf(file, key, "both 'port_forward_local' and 'port_forward_remote' are required")
+		}
+
+		// key files
+		keyFiles := map[string][]string{
+			"key":           {v.Key},
+			"cert":          {v.Cert},
+			"keys":          v.Keys,
+			"ssh_agent_key": v.SSHAgentKeyPath,
+		}
+		if !v.CertPKCS11 {
+			keyFiles["certkey"] = []string{v.CertKey}
+		}
+
+		fields := []string{}
+		for field := range keyFiles {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			for _, path := range keyFiles[field] {
+				// "keypath::passphrase"
+				path = strings.SplitN(ExpandEnv(path), "::", 2)[0]
+				if path == "" {
+					continue
+				}
+
+				if !common.IsExist(common.GetFullPath(path)) {
+					cc.errorf(file, key+"."+field, "key file is not found: %s", path)
+				}
+			}
+		}
+	}
+}
+
+// checkProxies check the merged proxy configs.
+func (cc *configChecker) checkProxies(c Config) {
+	names := []string{}
+	for name := range c.Proxy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		v := c.Proxy[name]
+		file := cc.proxySources[name]
+		key := "proxy." + name
+
+		if v.Addr == "" {
+			cc.errorf(file, key+".addr", "'addr' is not set")
+		}
+		if v.Port == "" {
+			cc.errorf(file, key+".port", "'port' is not set")
+		}
+
+		cc.checkProxyReference(c, file, key, v.Proxy, v.ProxyType)
+	}
+}
+
+// checkProxyReference check that proxy exists in config.
+func (cc *configChecker) checkProxyReference(c Config, file, key, proxy, proxyType string) {
+	if proxy == "" {
+		return
+	}
+
+	switch proxyType {
+	case "http", "https", "socks", "socks5":
+		if _, ok := c.Proxy[proxy]; !ok {
+			cc.errorf(file, key+".proxy", "proxy '%s' is not found in [proxy]", proxy)
+		}
+	case "", "ssh":
+		if _, ok := c.Server[proxy]; !ok {
+			cc.errorf(file, key+".proxy", "proxy server '%s' is not found in [server]", proxy)
+		}
+	default:
+		cc.errorf(file, key+".proxy_type", "unknown proxy_type '%s'", proxyType)
+	}
+}
+
+// checkGroups check the members of groups.
+func (cc *configChecker) checkGroups(c Config) {
+	names := []string{}
+	for name := range c.Group {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file := cc.groupSources[name]
+		for _, server := range c.Group[name].Servers {
+			if _, ok := c.Server[server]; !ok {
+				cc.warnf(file, "group."+name+".servers", "server '%s' is not found", server)
+			}
+		}
+	}
+}
+
+// getProxyChain return the proxy names of server, in order from the server.
+// If the proxy loops, it returns error.
+func getProxyChain(c Config, server string) (chain []string, err error) {
+	name, proxyType := server, "ssh"
+	visited := map[string]bool{}
+
+	for {
+		var next, nextType string
+		switch proxyType {
+		case "http", "https", "socks", "socks5":
+			next, nextType = c.Proxy[name].Proxy, c.Proxy[name].ProxyType
+		default:
+			s := c.Server[name]
+			if s.ProxyCommand != "" && s.ProxyCommand != "none" {
+				return
+			}
+			next, nextType = s.Proxy, s.ProxyType
+			proxyType = "ssh"
+		}
+
+		visitKey := proxyType + ":" + name
+		if visited[visitKey] {
+			err = fmt.Errorf("proxy loop: %s", strings.Join(append(chain, name), " -> "))
+			return
+		}
+		visited[visitKey] = true
+
+		if next == "" {
+			return
+		}
+
+		chain = append(chain, name)
+		name, proxyType = next, nextType
+	}
+}
+
+// unknownKeys return the keys in data, that are not defined in struct type t.
+func unknownKeys(data map[string]interface{}, t reflect.Type, prefix string, isYAML bool) (keys []string) {
+	fields := structFields(t, isYAML)
+
+	names := []string{}
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		lookup := name
+		if !isYAML {
+			lookup = strings.ToLower(name)
+		}
+
+		ft, ok := fields[lookup]
+		if !ok {
+			keys = append(keys, key)
+			continue
+		}
+
+		switch ft.Kind() {
+		case reflect.Struct:
+			if child, ok := data[name].(map[string]interface{}); ok {
+				keys = append(keys, unknownKeys(child, ft, key, isYAML)...)
+			}
+
+		case reflect.Map:
+			if ft.Elem().Kind() != reflect.Struct {
+				continue
+			}
+
+			child, ok := data[name].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			childNames := []string{}
+			for childName := range child {
+				childNames = append(childNames, childName)
+			}
+			sort.Strings(childNames)
+
+			for _, childName := range childNames {
+				if v, ok := child[childName].(map[string]interface{}); ok {
+					keys = append(keys, unknownKeys(v, ft.Elem(), key+"."+childName, isYAML)...)
+				}
+			}
+		}
+	}
+
+	return
+}
+
+// structFields return the map of key name and type of struct fields.
+// The key name is toml or yaml tag, or lower case field name if not tagged.
+// For TOML, the key name is lower case, because BurntSushi/toml matches it case-insensitively.
+func structFields(t reflect.Type, isYAML bool) map[string]reflect.Type {
+	tagName := "toml"
+	if isYAML {
+		tagName = "yaml"
+	}
+
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		// embedded struct
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			for k, v := range structFields(f.Type, isYAML) {
+				fields[k] = v
+			}
+			continue
+		}
+
+		// unexported field is not decoded
+		if f.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(f.Tag.Get(tagName), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if !isYAML {
+			name = strings.ToLower(name)
+		}
+
+		fields[name] = f.Type
+	}
+
+	return fields
+}
+
+// isYAMLFile returns true if the path is YAML file.
+func isYAMLFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package conf
+
+// GroupConfig is the group of servers.
+// Settings of group are applied to member servers, between [common] and [server].
+//
+// example:
+//
+//	[group.web]
+//	servers = ["web01", "web02"]
+//	user = "deploy"
+type GroupConfig struct {
+	// member server names.
+	// Servers with the tag of the same name as the group are also members.
+	Servers []string `toml:"servers" yaml:"servers"`
+
+	ServerConfig `yaml:",inline"`
+}
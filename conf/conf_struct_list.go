@@ -0,0 +1,34 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package conf
+
+// ListColumns is the columns that can be displayed in the list view.
+//   - name    ... server name (always displayed in the first column)
+//   - connect ... `user@addr`
+//   - user, addr, port, note, tags
+//   - proxy   ... proxy server name (or `command` if proxy_cmd is set)
+//   - source  ... the file (or the host source) that the server came from
+//   - last_used ... the last used time in the connection history
+var ListColumns = []string{"name", "connect", "user", "addr", "port", "proxy", "tags", "note", "source", "last_used"}
+
+// ListSortKeys is the sort keys of the list view. ListColumns and `frecency` (connection history).
+var ListSortKeys = append(append([]string{}, ListColumns...), "frecency")
+
+// DefaultListColumns is the default columns of the list view.
+var DefaultListColumns = []string{"name", "connect", "note"}
+
+// ListConfig store the settings of the list view (TUI).
+type ListConfig struct {
+	// Columns to display. default is ["name", "connect", "note"].
+	Columns []string `toml:"columns" yaml:"columns"`
+
+	// Max width of each column. The longer value is truncated.
+	// ex.) widths = { connect = 30, note = 20 }
+	Widths map[string]int `toml:"widths" yaml:"widths"`
+
+	// Default sort key (a column or "frecency"). default is "name".
+	// The sort key can be changed with Ctrl + S in the list view.
+	Sort string `toml:"sort" yaml:"sort"`
+}
@@ -4,26 +4,45 @@
 
 package conf
 
-// IncludeConfig specify the configuration file to include (ServerConfig only).
+// IncludeConfig specify the configuration file to include.
+// Path can be a glob pattern.
 type IncludeConfig struct {
-	Path string `toml:"path"`
+	Path string `toml:"path" yaml:"path"`
 }
 
-// IncludesConfig specify the configuration file to include (ServerConfig only).
-// Struct that can specify multiple files in array.
-// TODO: ワイルドカード指定可能にする
+// IncludesConfig specify the configuration file to include.
+// Struct that can specify multiple files (or glob patterns) in array.
 type IncludesConfig struct {
 	// example:
 	// 	path = [
 	// 		 "~/.lssh.d/home.conf"
 	// 		,"~/.lssh.d/cloud.conf"
+	// 		,"~/.lssh.d/teams/*.toml"
 	// 	]
-	Path []string `toml:"path"`
+	Path []string `toml:"path" yaml:"path"`
 }
 
 // OpenSSHConfig is read OpenSSH configuration file.
 type OpenSSHConfig struct {
-	Path    string `toml:"path"` // This is preferred
-	Command string `toml:"command"`
-	ServerConfig
+	Path         string `toml:"path" yaml:"path"` // This is preferred
+	Command      string `toml:"command" yaml:"command"`
+	ServerConfig `yaml:",inline"`
+}
+
+// InventoryConfig is read Ansible inventory (INI, YAML or JSON of dynamic inventory).
+type InventoryConfig struct {
+	Path         string `toml:"path" yaml:"path"` // This is preferred
+	Command      string `toml:"command" yaml:"command"`
+	ServerConfig `yaml:",inline"`
+}
+
+// DynamicConfig is the host source generated by command.
+// The command outputs the JSON array of host records (name, addr, user, port, note, tags...).
+type DynamicConfig struct {
+	Command string `toml:"command" yaml:"command"`
+
+	// cache TTL (second) of the command output. default is 600. If negative, the cache is not used.
+	CacheTTL int `toml:"cache_ttl" yaml:"cache_ttl"`
+
+	ServerConfig `yaml:",inline"`
 }
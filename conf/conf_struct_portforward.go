@@ -4,9 +4,56 @@
 
 package conf
 
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
 // PortForward
 type PortForward struct {
 	Mode   string // L or R.
 	Local  string // localhost:8080
 	Remote string // localhost:80
 }
+
+// ParsePortForward parse the port_forwards value of config, and return *PortForward.
+//
+// ex.)
+//   - `local:localhost:8080:localhost:80`
+//   - `L:8080:localhost:80`
+//   - `remote:localhost:2222:12222`
+func ParsePortForward(value string) (fw *PortForward, err error) {
+	err = fmt.Errorf("port forward format is incorrect: \"%s\"", value)
+
+	// split config forward settings
+	farray := strings.SplitN(value, ":", 2)
+
+	// check array count
+	if len(farray) == 1 {
+		return nil, err
+	}
+
+	fw = new(PortForward)
+
+	mode := strings.ToLower(farray[0])
+	switch mode {
+	// local/remote port forward
+	case "local", "l":
+		fw.Mode = "L"
+	case "remote", "r":
+		fw.Mode = "R"
+
+	// other
+	default:
+		return nil, err
+	}
+
+	fw.Local, fw.Remote, err = common.ParseForwardPort(farray[1])
+	if err != nil {
+		return nil, fmt.Errorf("port forward format is incorrect: \"%s\"", value)
+	}
+
+	return fw, nil
+}
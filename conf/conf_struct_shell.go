@@ -7,33 +7,37 @@ package conf
 // ShellConfig Structure for storing lssh-shell(parallel shell) settings.
 type ShellConfig struct {
 	// prompt
-	Prompt  string `toml:"PROMPT"`  // lssh shell(parallel shell) prompt
-	OPrompt string `toml:"OPROMPT"` // lssh shell(parallel shell) output prompt
+	Prompt  string `toml:"PROMPT" yaml:"PROMPT"`   // lssh shell(parallel shell) prompt
+	OPrompt string `toml:"OPROMPT" yaml:"OPROMPT"` // lssh shell(parallel shell) output prompt
 
 	// message,title etc...
-	Title string `toml:"title"`
+	Title string `toml:"title" yaml:"title"`
 
 	// history file
-	HistoryFile string `toml:"histfile"`
+	HistoryFile string `toml:"histfile" yaml:"histfile"`
 
 	// pre | post command setting
-	PreCmd  string `toml:"pre_cmd"`
-	PostCmd string `toml:"post_cmd"`
+	PreCmd  string `toml:"pre_cmd" yaml:"pre_cmd"`
+	PostCmd string `toml:"post_cmd" yaml:"post_cmd"`
+
+	// max number of servers connecting at the same time in command mode and pshell.
+	// 0 is unlimited. `--forks` option takes precedence.
+	Forks int `toml:"forks" yaml:"forks"`
 
 	// alias
-	Alias map[string]ShellAliasConfig `toml:"alias"`
+	Alias map[string]ShellAliasConfig `toml:"alias" yaml:"alias"`
 
 	// outexec
-	OutexecCmdConfigs map[string]ShellOutexecCmdConfig `toml:"outexecs"`
+	OutexecCmdConfigs map[string]ShellOutexecCmdConfig `toml:"outexecs" yaml:"outexecs"`
 }
 
 type ShellAliasConfig struct {
 	// command
-	Command string `toml:"command"`
+	Command string `toml:"command" yaml:"command"`
 }
 
 // OutexecCmdConfig
 type ShellOutexecCmdConfig struct {
 	// path
-	Path string `toml:"path"`
+	Path string `toml:"path" yaml:"path"`
 }
@@ -5,6 +5,8 @@
 package conf
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -160,3 +162,653 @@ func TestGetNameList(t *testing.T) {
 		assert.Equal(t, v.expect, got, v.desc)
 	}
 }
+
+func TestExpandHosts(t *testing.T) {
+	c := Config{
+		Group: map[string]GroupConfig{
+			"web": {Servers: []string{"web02", "web01"}},
+		},
+		Server: map[string]ServerConfig{
+			"web01": {},
+			"web02": {},
+			"web03": {Tags: []string{"web"}},
+			"db01":  {Tags: []string{"db"}},
+		},
+	}
+
+	type TestData struct {
+		desc      string
+		hosts     []string
+		expect    []string
+		expectErr bool
+	}
+	tds := []TestData{
+		{desc: "No group", hosts: []string{"web01", "db01"}, expect: []string{"web01", "db01"}},
+		{desc: "Group members and tag", hosts: []string{"@web"}, expect: []string{"web01", "web02", "web03"}},
+		{desc: "Tag only", hosts: []string{"@db"}, expect: []string{"db01"}},
+		{desc: "Duplicate servers are removed", hosts: []string{"web01", "@web"}, expect: []string{"web01", "web02", "web03"}},
+		{desc: "Group not found", hosts: []string{"@app"}, expectErr: true},
+		{desc: "Glob", hosts: []string{"web*"}, expect: []string{"web01", "web02", "web03"}},
+		{desc: "Regex", hosts: []string{"/^(db|web)0[1]$/"}, expect: []string{"db01", "web01"}},
+		{desc: "Pattern not match", hosts: []string{"app*"}, expectErr: true},
+		{desc: "Invalid regex", hosts: []string{"/web(/"}, expectErr: true},
+	}
+	for _, v := range tds {
+		got, err := c.ExpandHosts(v.hosts)
+		if v.expectErr {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestExcludeHosts(t *testing.T) {
+	c := Config{
+		Server: map[string]ServerConfig{
+			"web01": {},
+			"web02": {},
+			"web03": {Tags: []string{"canary"}},
+			"db01":  {},
+		},
+	}
+	hosts := []string{"web01", "web02", "web03", "db01"}
+
+	type TestData struct {
+		desc      string
+		excludes  []string
+		expect    []string
+		expectErr bool
+	}
+	tds := []TestData{
+		{desc: "No excludes", excludes: nil, expect: hosts},
+		{desc: "Name", excludes: []string{"web02"}, expect: []string{"web01", "web03", "db01"}},
+		{desc: "Tag and regex", excludes: []string{"@canary", "/^db/"}, expect: []string{"web01", "web02"}},
+		{desc: "Glob not match", excludes: []string{"app*"}, expect: hosts},
+		{desc: "Group not found", excludes: []string{"@app"}, expectErr: true},
+	}
+	for _, v := range tds {
+		got, err := c.ExcludeHosts(hosts, v.excludes)
+		if v.expectErr {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestReduceGroup(t *testing.T) {
+	c := Config{
+		Common: ServerConfig{User: "common", Port: "22"},
+		Group: map[string]GroupConfig{
+			"web": {Servers: []string{"web01"}, ServerConfig: ServerConfig{User: "web", Note: "web group"}},
+			"app": {ServerConfig: ServerConfig{User: "app", Port: "2222"}},
+		},
+		Server: map[string]ServerConfig{
+			"web01": {Addr: "192.168.100.101"},
+			"web02": {Addr: "192.168.100.102", User: "test", Tags: []string{"web"}},
+			"app01": {Addr: "192.168.100.103", Tags: []string{"app", "web"}},
+			"db01":  {Addr: "192.168.100.104"},
+		},
+	}
+	c.ReduceCommon()
+
+	type TestData struct {
+		desc   string
+		server string
+		expect ServerConfig
+	}
+	tds := []TestData{
+		{desc: "Group setting is applied", server: "web01", expect: ServerConfig{Addr: "192.168.100.101", User: "web", Port: "22"}},
+		{desc: "Server setting takes precedence", server: "web02", expect: ServerConfig{Addr: "192.168.100.102", User: "test", Port: "22", Tags: []string{"web"}}},
+		{desc: "Multiple groups are applied in order of name", server: "app01", expect: ServerConfig{Addr: "192.168.100.103", User: "app", Port: "2222", Tags: []string{"app", "web"}}},
+		{desc: "Not group member", server: "db01", expect: ServerConfig{Addr: "192.168.100.104", User: "common", Port: "22"}},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.expect, c.Server[v.server], v.desc)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("LSSH_TEST_USER", "user1")
+
+	type TestData struct {
+		desc   string
+		value  string
+		expect string
+	}
+	tds := []TestData{
+		{desc: "No env", value: "user", expect: "user"},
+		{desc: "Env", value: "${env:LSSH_TEST_USER}", expect: "user1"},
+		{desc: "Env in string", value: "${env:LSSH_TEST_USER}@example.com", expect: "user1@example.com"},
+		{desc: "Env is not set", value: "${env:LSSH_TEST_NOT_SET}", expect: ""},
+		{desc: "Shell style is not replaced", value: "${LSSH_TEST_USER}", expect: "${LSSH_TEST_USER}"},
+	}
+	for _, v := range tds {
+		got := ExpandEnv(v.value)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestResolveServerConfig(t *testing.T) {
+	t.Setenv("LSSH_TEST_ADDR", "192.168.100.101")
+
+	c := Config{
+		Server: map[string]ServerConfig{
+			"a": {Addr: "${env:LSSH_TEST_ADDR}", Pass: "plain", PassCommand: "echo secret", Keys: []string{"~/.ssh/${env:LSSH_TEST_ADDR}"}},
+			"b": {PassCommand: "exit 1"},
+		},
+	}
+
+	err := c.ResolveServerConfig("a")
+	assert.NoError(t, err)
+	assert.Equal(t, ServerConfig{Addr: "192.168.100.101", Pass: "secret", Keys: []string{"~/.ssh/192.168.100.101"}}, c.Server["a"])
+
+	err = c.ResolveServerConfig("b")
+	assert.Error(t, err)
+}
+
+func TestDecodeFile(t *testing.T) {
+	dir := t.TempDir()
+
+	type TestData struct {
+		desc string
+		name string
+		data string
+	}
+	tds := []TestData{
+		{
+			desc: "TOML",
+			name: "lssh.conf",
+			data: "[common]\nuser = \"user1\"\n[server.a]\naddr = \"192.168.100.101\"\nkeycmd = \"cat key\"\n[sshconfig.default]\npath = \"~/.ssh/config\"\npass = \"pass\"\n",
+		},
+		{
+			desc: "YAML",
+			name: "lssh.yaml",
+			data: "common:\n  user: user1\nserver:\n  a:\n    addr: 192.168.100.101\n    keycmd: cat key\nsshconfig:\n  default:\n    path: ~/.ssh/config\n    pass: pass\n",
+		},
+		{
+			desc: "YAML (.yml)",
+			name: "lssh.yml",
+			data: "common:\n  user: user1\nserver:\n  a:\n    addr: 192.168.100.101\n    keycmd: cat key\nsshconfig:\n  default:\n    path: ~/.ssh/config\n    pass: pass\n",
+		},
+	}
+	for _, v := range tds {
+		path := filepath.Join(dir, v.name)
+		err := os.WriteFile(path, []byte(v.data), 0600)
+		assert.NoError(t, err, v.desc)
+
+		var c Config
+		err = decodeFile(path, &c)
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, "user1", c.Common.User, v.desc)
+		assert.Equal(t, ServerConfig{Addr: "192.168.100.101", KeyCommand: "cat key"}, c.Server["a"], v.desc)
+		assert.Equal(t, "~/.ssh/config", c.SSHConfig["default"].Path, v.desc)
+		assert.Equal(t, "pass", c.SSHConfig["default"].Pass, v.desc)
+	}
+
+	// malformed YAML
+	path := filepath.Join(dir, "broken.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("server:\n  a:\n    addr: [192.168.100.101\n"), 0600))
+
+	var c Config
+	assert.Error(t, decodeFile(path, &c))
+}
+
+func TestCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "lssh.conf")
+	include := filepath.Join(dir, "include.yaml")
+
+	data := `
+serversources = "x"
+
+[common]
+user = "user1"
+pass = "pass"
+unknown_key = "x"
+
+[server.a]
+addr = "192.168.100.101"
+proxy = "b"
+port_forwards = ["L:8080"]
+
+[server.b]
+addr = "192.168.100.102"
+proxy = "a"
+
+[server.c]
+addr = "192.168.100.103"
+proxy = "p"
+proxy_type = "http"
+key = "` + filepath.Join(dir, "not_exist_key") + `"
+
+[includes]
+path = ["` + include + `"]
+
+# not read ~/.ssh/config
+[sshconfig.empty]
+command = "true"
+
+[list]
+columns = ["name", "port", "unknown"]
+sort = "port"
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	assert.NoError(t, os.WriteFile(include, []byte("server:\n  c:\n    addr: 192.168.100.104\n    proxy: p\n    proxy_type: http\n"), 0600))
+
+	problems := []string{}
+	for _, p := range CheckConfig(path) {
+		problems = append(problems, p.String())
+	}
+
+	expect := []string{
+		path + ": common.unknown_key: error: unknown key",
+		path + ": serversources: error: unknown key",
+		include + ": server.c: warning: server name is overwritten (previously defined in " + path + ")",
+		path + ": server.a.proxy: error: proxy loop: a -> b -> a",
+		path + `: server.a.port_forwards: error: port forward format is incorrect: "L:8080"`,
+		path + ": server.b.proxy: error: proxy loop: b -> a -> b",
+		include + ": server.c.proxy: error: proxy 'p' is not found in [proxy]",
+		path + ": list.columns: error: unknown column 'unknown' (name|connect|user|addr|port|proxy|tags|note|source|last_used)",
+	}
+	assert.Equal(t, expect, problems)
+}
+
+func TestGetOpenSSHConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	include := filepath.Join(dir, "config.d", "bastion.conf")
+
+	data := `
+Host web
+    HostName 192.168.100.101
+    IdentityFile /keys/id_a
+    IdentityFile /keys/id_b
+    LocalForward 8080 localhost:80
+    LocalForward 127.0.0.1:8443 localhost:443
+    RemoteForward 10080
+    RemoteForward 10022 localhost:22
+    ProxyJump bastion,admin@inner:2222
+
+Match originalhost web exec "true"
+    ServerAliveInterval 30
+
+Include ` + filepath.Join(dir, "config.d", "*.conf") + `
+
+Host *
+    User user1
+    Port 2222
+    ConnectTimeout 10
+    ForwardAgent yes
+`
+	assert.NoError(t, os.MkdirAll(filepath.Dir(include), 0700))
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	assert.NoError(t, os.WriteFile(include, []byte("Host bastion\n    HostName 192.168.100.1\n    Port 22\n"), 0600))
+
+	config, err := getOpenSSHConfig(path, "")
+	assert.NoError(t, err)
+
+	web := config[path+":web"]
+	assert.Equal(t, "192.168.100.101", web.Addr)
+	assert.Equal(t, "2222", web.Port)
+	assert.Equal(t, "user1", web.User)
+	assert.Equal(t, []string{"/keys/id_a", "/keys/id_b"}, web.Keys)
+	assert.Equal(t, []string{"L:8080:localhost:80", "L:127.0.0.1:8443:localhost:443", "R:localhost:22:10022"}, web.PortForwards)
+	assert.Equal(t, "10080", web.ReverseDynamicPortForward)
+	assert.Equal(t, 30, web.ServerAliveCountInterval)
+	assert.Equal(t, 10, web.ConnectTimeout)
+	assert.True(t, web.SSHAgentUse)
+	assert.Equal(t, path+":bastion>admin@inner:2222", web.Proxy)
+
+	bastion := config[path+":bastion"]
+	assert.Equal(t, "192.168.100.1", bastion.Addr)
+	assert.Equal(t, "22", bastion.Port)
+	assert.Equal(t, 0, bastion.ServerAliveCountInterval)
+
+	inner := config[path+":bastion>admin@inner:2222"]
+	assert.Equal(t, "inner", inner.Addr)
+	assert.Equal(t, "admin", inner.User)
+	assert.Equal(t, "2222", inner.Port)
+	assert.Equal(t, path+":bastion", inner.Proxy)
+}
+
+func TestGetOpenSSHConfigProxyJump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+
+	// inner is also declared as Host after target, without ProxyJump.
+	data := `
+Host target
+    HostName 192.168.100.103
+    ProxyJump bastion,inner
+
+Host inner
+    HostName 192.168.100.102
+
+Host bastion
+    HostName 192.168.100.101
+`
+	assert.NoError(t, os.WriteFile(path, []byte(data), 0600))
+
+	config, err := getOpenSSHConfig(path, "")
+	assert.NoError(t, err)
+
+	target := config[path+":target"]
+	assert.Equal(t, path+":bastion>inner", target.Proxy)
+
+	route := config[path+":bastion>inner"]
+	assert.Equal(t, "192.168.100.102", route.Addr)
+	assert.Equal(t, path+":bastion", route.Proxy)
+
+	// declared Host is not changed by ProxyJump of other host.
+	assert.Equal(t, "192.168.100.102", config[path+":inner"].Addr)
+	assert.Equal(t, "", config[path+":inner"].Proxy)
+	assert.Equal(t, "", config[path+":bastion"].Proxy)
+}
+
+func TestReadIncludeFiles(t *testing.T) {
+	dir := t.TempDir()
+	includeDir := filepath.Join(dir, "lssh.d")
+	assert.NoError(t, os.MkdirAll(includeDir, 0700))
+
+	files := map[string]string{
+		// b.toml is read after a.toml, and overwrites server x.
+		filepath.Join(includeDir, "a.toml"): "[common]\nuser = \"user_a\"\n[server.x]\naddr = \"192.168.100.1\"\n[server.a1]\naddr = \"192.168.100.2\"\n[includes]\npath = [\"nested/*.toml\"]\n",
+		filepath.Join(includeDir, "b.toml"): "[server.x]\naddr = \"192.168.100.3\"\nproxy = \"p\"\n[proxy.p]\naddr = \"192.168.100.254\"\nport = \"8080\"\n[group.web]\nservers = [\"main\"]\nport = \"2222\"\n",
+		// nested include inherits common of a.toml. relative path is from the directory of the file.
+		filepath.Join(includeDir, "nested", "n.toml"): "[server.n1]\naddr = \"192.168.100.4\"\n[includes]\npath = [\"../c.yaml\"]\n",
+		filepath.Join(includeDir, "c.yaml"):           "server:\n  c1:\n    addr: 192.168.100.5\n",
+	}
+	for path, data := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		assert.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	}
+
+	c := Config{
+		Common:   ServerConfig{User: "user", Pass: "pass"},
+		Server:   map[string]ServerConfig{"main": {Addr: "192.168.100.100"}},
+		Includes: IncludesConfig{Path: []string{filepath.Join(includeDir, "*.toml")}},
+	}
+	assert.NoError(t, c.readIncludeSettings())
+	c.ReduceCommon()
+	c.ReadIncludeFiles()
+
+	paths := []string{}
+	for _, f := range c.includeFiles {
+		paths = append(paths, f.Path)
+	}
+	assert.Equal(t, []string{
+		filepath.Join(includeDir, "a.toml"),
+		filepath.Join(includeDir, "nested", "n.toml"),
+		filepath.Join(includeDir, "c.yaml"),
+		filepath.Join(includeDir, "b.toml"),
+	}, paths)
+
+	assert.Equal(t, "192.168.100.3", c.Server["x"].Addr)
+	assert.Equal(t, "p", c.Server["x"].Proxy)
+	assert.Equal(t, "user", c.Server["x"].User)
+	assert.Equal(t, "user_a", c.Server["a1"].User)
+	assert.Equal(t, "user_a", c.Server["n1"].User)
+	assert.Equal(t, "user_a", c.Server["c1"].User)
+	assert.Equal(t, "pass", c.Server["c1"].Pass)
+	assert.Equal(t, "8080", c.Proxy["p"].Port)
+	assert.Equal(t, "2222", c.Server["main"].Port)
+
+	// include loop
+	loop := filepath.Join(dir, "loop.toml")
+	assert.NoError(t, os.WriteFile(loop, []byte("[includes]\npath = [\""+filepath.Join(includeDir, "loop2.toml")+"\"]\n"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(includeDir, "loop2.toml"), []byte("[includes]\npath = [\"../loop.toml\"]\n"), 0600))
+
+	c = Config{Includes: IncludesConfig{Path: []string{loop}}}
+	err := c.readIncludeSettings()
+	assert.EqualError(t, err, "include loop: "+loop+" -> "+filepath.Join(includeDir, "loop2.toml")+" -> "+loop)
+
+	// malformed YAML include file
+	broken := filepath.Join(dir, "broken.yaml")
+	assert.NoError(t, os.WriteFile(broken, []byte("server:\n  b1:\n    addr: [192.168.100.6\n"), 0600))
+
+	c = Config{Includes: IncludesConfig{Path: []string{broken}}}
+	err = c.readIncludeSettings()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), broken)
+
+	// --check-config reports the malformed include file
+	mainPath := filepath.Join(dir, "main.conf")
+	assert.NoError(t, os.WriteFile(mainPath, []byte("[includes]\npath = [\""+broken+"\"]\n[sshconfig.empty]\ncommand = \"true\"\n"), 0600))
+
+	problems := CheckConfig(mainPath)
+	assert.Equal(t, 1, len(problems))
+	assert.Contains(t, problems[0].String(), broken)
+}
+
+func TestExport(t *testing.T) {
+	c := Config{
+		Server: map[string]ServerConfig{
+			"bastion": {Addr: "192.168.100.1", Port: "2222", User: "user1", Pass: "pass"},
+			"web01": {
+				Addr: "192.168.100.101", User: "user1", Pass: "pass", Key: "~/.ssh/id_rsa", Keys: []string{"~/.ssh/id_ed25519::passphrase"},
+				Proxy: "bastion", PortForwards: []string{"L:8080:localhost:80", "R:localhost:22:10022"},
+			},
+			"web02": {Addr: "192.168.100.102", User: "user1", Pass: "pass", Proxy: "http", ProxyType: "http"},
+		},
+		Proxy: map[string]ProxyConfig{
+			"http": {Addr: "192.168.100.254", Port: "8080"},
+		},
+	}
+
+	// ssh_config (proxy server is also exported)
+	data, warnings, err := c.Export(EXPORT_FORMAT_SSH_CONFIG, []string{"web01"}, false)
+	assert.NoError(t, err)
+	assert.Empty(t, warnings)
+	assert.Equal(t, `Host web01
+    HostName 192.168.100.101
+    User user1
+    IdentityFile ~/.ssh/id_rsa
+    IdentityFile ~/.ssh/id_ed25519
+    ProxyJump bastion
+    LocalForward localhost:8080 localhost:80
+    RemoteForward localhost:10022 localhost:22
+
+Host bastion
+    HostName 192.168.100.1
+    Port 2222
+    User user1
+
+`, string(data))
+
+	// ansible-ini
+	data, _, err = c.Export(EXPORT_FORMAT_ANSIBLE_INI, []string{"web01", "web02"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, `[all]
+web01 ansible_host=192.168.100.101 ansible_user=user1 ansible_ssh_private_key_file=~/.ssh/id_rsa ansible_ssh_common_args="-o ProxyJump=user1@192.168.100.1:2222"
+web02 ansible_host=192.168.100.102 ansible_user=user1 ansible_ssh_common_args="-o 'ProxyCommand=nc -X connect -x 192.168.100.254:8080 %h %p'"
+`, string(data))
+
+	// secrets are omitted unless withSecret
+	data, _, err = c.Export(EXPORT_FORMAT_JSON, []string{"bastion"}, false)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"pass"`)
+
+	data, _, err = c.Export(EXPORT_FORMAT_JSON, []string{"bastion"}, true)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"pass": "pass"`)
+
+	_, _, err = c.Export("unknown", nil, false)
+	assert.Error(t, err)
+}
+
+func TestGetInventoryConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	type TestData struct {
+		desc   string
+		name   string
+		data   string
+		expect map[string]ServerConfig
+		groups map[string][]string
+	}
+	tds := []TestData{
+		{
+			desc: "INI",
+			name: "hosts",
+			data: `bastion ansible_host=192.168.100.1
+
+[web]
+web[01:02] ansible_port=2222
+web03:2200 ansible_ssh_common_args='-o ProxyCommand="nc -x proxy:1080 %h %p"'
+
+[web:vars]
+ansible_user=user1
+ansible_ssh_common_args="-J bastion,user2@192.168.100.2:22"
+
+[prod:children]
+web
+`,
+			expect: map[string]ServerConfig{
+				"inv:bastion":                        {Addr: "192.168.100.1", Note: "from:inventory.inv"},
+				"inv:web01":                          {Addr: "web01", Port: "2222", User: "user1", Proxy: "inv:bastion>user2@192.168.100.2:22", Note: "from:inventory.inv"},
+				"inv:web02":                          {Addr: "web02", Port: "2222", User: "user1", Proxy: "inv:bastion>user2@192.168.100.2:22", Note: "from:inventory.inv"},
+				"inv:web03":                          {Addr: "web03", Port: "2200", User: "user1", ProxyCommand: "nc -x proxy:1080 %h %p", Note: "from:inventory.inv"},
+				"inv:bastion>user2@192.168.100.2:22": {Addr: "192.168.100.2", Port: "22", User: "user2", Proxy: "inv:bastion", Note: "from:inventory.inv (ProxyJump)"},
+			},
+			groups: map[string][]string{
+				"web":  {"inv:web01", "inv:web02", "inv:web03"},
+				"prod": {"inv:web01", "inv:web02", "inv:web03"},
+			},
+		},
+		{
+			desc: "YAML",
+			name: "hosts.yml",
+			data: `all:
+  vars:
+    ansible_user: user1
+  children:
+    web:
+      vars:
+        ansible_user: user2
+      hosts:
+        web01:
+          ansible_host: 192.168.100.101
+          ansible_port: 2222
+          ansible_ssh_private_key_file: /keys/id_rsa
+`,
+			expect: map[string]ServerConfig{
+				"inv:web01": {Addr: "192.168.100.101", Port: "2222", User: "user2", Key: "/keys/id_rsa", Note: "from:inventory.inv"},
+			},
+			groups: map[string][]string{
+				"web": {"inv:web01"},
+			},
+		},
+		{
+			desc: "JSON (dynamic inventory)",
+			name: "inventory.json",
+			data: `{"_meta": {"hostvars": {"web01": {"ansible_host": "192.168.100.101", "ansible_port": 22}}}, "web": {"hosts": ["web01"], "vars": {"ansible_user": "user1"}}}`,
+			expect: map[string]ServerConfig{
+				"inv:web01": {Addr: "192.168.100.101", Port: "22", User: "user1", Note: "from:inventory.inv"},
+			},
+			groups: map[string][]string{
+				"web": {"inv:web01"},
+			},
+		},
+	}
+	for _, v := range tds {
+		path := filepath.Join(dir, v.name)
+		assert.NoError(t, os.WriteFile(path, []byte(v.data), 0600), v.desc)
+
+		servers, groups, err := getInventoryConfig("inv", path, "")
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, v.expect, servers, v.desc)
+		assert.Equal(t, v.groups, groups, v.desc)
+	}
+}
+
+func TestGetDynamicConfig(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", dir)
+
+	output := filepath.Join(dir, "output.json")
+	command := "cat " + output
+	dc := DynamicConfig{Command: command}
+
+	assert.NoError(t, os.WriteFile(output, []byte(`[{"name": "web01", "addr": "192.168.100.101", "user": "user1", "port": 2222, "tags": ["web"]}, {"name": "web02"}]`), 0600))
+
+	expect := map[string]ServerConfig{
+		"cloud:web01": {Addr: "192.168.100.101", User: "user1", Port: "2222", Tags: []string{"web"}, Note: "from:dynamic.cloud"},
+		"cloud:web02": {Addr: "web02", Note: "from:dynamic.cloud"},
+	}
+
+	// run command, and write cache
+	servers, warning, err := getDynamicConfig("cloud", dc)
+	assert.NoError(t, err)
+	assert.Empty(t, warning)
+	assert.Equal(t, expect, servers)
+	assert.FileExists(t, filepath.Join(dir, "lssh", "dynamic", "cloud.json"))
+
+	// cache is used
+	assert.NoError(t, os.WriteFile(output, []byte(`[{"name": "db01"}]`), 0600))
+	servers, _, err = getDynamicConfig("cloud", dc)
+	assert.NoError(t, err)
+	assert.Equal(t, expect, servers)
+
+	// refresh
+	RefreshDynamic = true
+	defer func() { RefreshDynamic = false }()
+
+	servers, _, err = getDynamicConfig("cloud", dc)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cloud:db01"}, GetNameList(Config{Server: servers}))
+
+	// command failed, use expired cache
+	assert.NoError(t, os.WriteFile(output, []byte(`not json`), 0600))
+	servers, warning, err = getDynamicConfig("cloud", dc)
+	assert.NoError(t, err)
+	assert.Contains(t, warning, "use the cache of")
+	assert.Equal(t, []string{"cloud:db01"}, GetNameList(Config{Server: servers}))
+
+	// no cache
+	_, _, err = getDynamicConfig("other", dc)
+	assert.Error(t, err)
+}
+
+func TestVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lssh.vault")
+
+	v, err := InitVault(path, "passphrase")
+	assert.NoError(t, err)
+	v.Set("prod/db01", "secret")
+	v.Set("prod/key", "keypass")
+	assert.NoError(t, v.Save())
+
+	_, err = InitVault(path, "passphrase")
+	assert.Error(t, err)
+
+	// wrong passphrase
+	_, err = OpenVault(path, "wrong")
+	assert.Error(t, err)
+
+	v, err = OpenVault(path, "passphrase")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prod/db01", "prod/key"}, v.Names())
+	assert.True(t, v.Remove("prod/key"))
+	assert.False(t, v.Remove("prod/key"))
+
+	// resolve vault references
+	VaultPath, VaultPassphrase = path, "passphrase"
+	defer func() { VaultPath, VaultPassphrase, unlockedVault = "", "", nil }()
+
+	c := Config{
+		Server: map[string]ServerConfig{
+			"a": {Pass: "vault:prod/db01", Keys: []string{"~/.ssh/id_rsa::vault:prod/db01", "~/.ssh/id_ed25519"}},
+			"b": {Pass: "vault:unknown"},
+		},
+	}
+
+	err = c.ResolveServerConfig("a")
+	assert.NoError(t, err)
+	assert.Equal(t, ServerConfig{Pass: "secret", Keys: []string{"~/.ssh/id_rsa::secret", "~/.ssh/id_ed25519"}}, c.Server["a"])
+
+	err = c.ResolveServerConfig("b")
+	assert.Error(t, err)
+}
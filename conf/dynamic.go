@@ -0,0 +1,238 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the dynamic host source ([dynamic.<name>]).
+// The command outputs the JSON array of host records, and the result is cached on disk with TTL.
+//
+// ex.)
+//
+//	[
+//	  {"name": "web01", "addr": "192.168.100.101", "user": "user", "port": 22, "note": "web server", "tags": ["web"]}
+//	]
+
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDynamicCacheTTL is the default cache TTL (second) of dynamic host source.
+const DefaultDynamicCacheTTL = 600
+
+// RefreshDynamic is true, the cache of dynamic host sources is not used, and the commands are run (`--refresh`).
+var RefreshDynamic = false
+
+// dynamicRecord is a host record of the dynamic host source.
+// Other than name, the keys of ServerConfig (addr, user, port, note, tags, key...) can be used.
+type dynamicRecord struct {
+	Name         string `yaml:"name"`
+	ServerConfig `yaml:",inline"`
+}
+
+// dynamicCache is the cache file of dynamic host source.
+type dynamicCache struct {
+	Command string          `json:"command"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// ReadDynamic run the commands of dynamic host sources (or read the cache), and append to Config.Server.
+func (c *Config) ReadDynamic() {
+	for _, name := range c.getDynamicNames() {
+		dc := c.Dynamic[name]
+
+		servers, warning, err := getDynamicConfig(name, dc)
+		if warning != "" {
+			fmt.Fprintf(os.Stderr, "Warning: dynamic.%s: %s\n", name, warning)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: dynamic.%s: %s\n", name, err)
+			continue
+		}
+
+		setCommon := serverConfigReduct(c.Common, dc.ServerConfig)
+		for key, value := range servers {
+			value = c.reduceGroup(key, value)
+			value = serverConfigReduct(setCommon, value)
+			c.Server[key] = value
+			c.setServerSource(key, getSourceText("dynamic."+name, "", dc.Command))
+		}
+	}
+}
+
+// getDynamicNames return the names of [dynamic] in sorted order.
+func (c *Config) getDynamicNames() (names []string) {
+	for name := range c.Dynamic {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// getDynamicConfig return the servers of dynamic host source. The server name is `<name>:<record name>`.
+// If the cache is valid, it is used. If the command failed and the cache exists, the expired cache is used with warning.
+func getDynamicConfig(name string, dc DynamicConfig) (servers map[string]ServerConfig, warning string, err error) {
+	if dc.Command == "" {
+		return nil, "", fmt.Errorf("command is not set")
+	}
+
+	ttl := dc.CacheTTL
+	if ttl == 0 {
+		ttl = DefaultDynamicCacheTTL
+	}
+
+	cachePath := getDynamicCachePath(name)
+	cache, cacheTime, cacheErr := readDynamicCache(cachePath, dc.Command)
+
+	var data []byte
+	switch {
+	case cacheErr == nil && !RefreshDynamic && ttl > 0 && time.Since(cacheTime) < time.Duration(ttl)*time.Second:
+		data = cache
+
+	default:
+		data, err = runDynamicCommand(dc.Command)
+		if err == nil {
+			_, err = parseDynamicRecords(name, data)
+		}
+
+		if err != nil {
+			if cacheErr != nil {
+				return
+			}
+
+			// use expired cache
+			warning = fmt.Sprintf("%s. use the cache of %s", err, cacheTime.Format(time.RFC3339))
+			data, err = cache, nil
+			break
+		}
+
+		if ttl > 0 {
+			if werr := writeDynamicCache(cachePath, dc.Command, data); werr != nil {
+				warning = fmt.Sprintf("write cache error: %s", werr)
+			}
+		}
+	}
+
+	servers, err = parseDynamicRecords(name, data)
+	return
+}
+
+// runDynamicCommand run the command of dynamic host source, and return the stdout.
+func runDynamicCommand(command string) (data []byte, err error) {
+	data, err = exec.Command("sh", "-c", command).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			err = fmt.Errorf("command failed: %s: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		} else {
+			err = fmt.Errorf("command failed: %s", err)
+		}
+	}
+
+	return
+}
+
+// parseDynamicRecords parse the JSON array of host records, and return the servers.
+func parseDynamicRecords(name string, data []byte) (servers map[string]ServerConfig, err error) {
+	records := []dynamicRecord{}
+
+	// JSON is read as YAML, so that number can be set to string (port etc).
+	err = yaml.Unmarshal(data, &records)
+	if err != nil {
+		return nil, fmt.Errorf("parse error: %s", err)
+	}
+
+	servers = map[string]ServerConfig{}
+	for i, r := range records {
+		if r.Name == "" {
+			return nil, fmt.Errorf("parse error: name is not set in record %d", i)
+		}
+
+		if r.Addr == "" {
+			r.Addr = r.Name
+		}
+		if r.Note == "" {
+			r.Note = "from:dynamic." + name
+		}
+
+		servers[name+":"+r.Name] = r.ServerConfig
+	}
+
+	return
+}
+
+// getDynamicCachePath return the cache file path of dynamic host source.
+// `${XDG_CACHE_HOME}/lssh/dynamic/<name>.json` (default is `~/.cache/lssh/dynamic/<name>.json`).
+func getDynamicCachePath(name string) string {
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		usr, _ := user.Current()
+		dir = filepath.Join(usr.HomeDir, ".cache")
+	}
+
+	return filepath.Join(dir, "lssh", "dynamic", strings.Replace(name, string(filepath.Separator), "_", -1)+".json")
+}
+
+// readDynamicCache read the cache file, and return the data and the time of cache.
+// If the command is changed, the cache is invalid.
+func readDynamicCache(path, command string) (data []byte, cacheTime time.Time, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	cache := dynamicCache{}
+	err = json.Unmarshal(raw, &cache)
+	if err != nil {
+		return
+	}
+
+	if cache.Command != command {
+		err = fmt.Errorf("command is changed")
+		return
+	}
+
+	return cache.Data, info.ModTime(), nil
+}
+
+// writeDynamicCache write the cache file.
+func writeDynamicCache(path, command string, data []byte) (err error) {
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return
+	}
+
+	// data must be valid JSON for json.RawMessage
+	if !json.Valid(data) {
+		return fmt.Errorf("output is not JSON")
+	}
+
+	raw, err := json.Marshal(dynamicCache{Command: command, Data: data})
+	if err != nil {
+		return
+	}
+
+	// write to temp file and rename, not to read the half written cache.
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, raw, 0600)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,566 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code to export the merged config to the other tools format.
+// Secrets (pass, passphrase, PIN) are omitted unless withSecret is true.
+
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EXPORT_FORMAT_SSH_CONFIG   = "ssh_config"
+	EXPORT_FORMAT_ANSIBLE_INI  = "ansible-ini"
+	EXPORT_FORMAT_ANSIBLE_YAML = "ansible-yaml"
+	EXPORT_FORMAT_JSON         = "json"
+)
+
+// ExportFormats is the list of export formats.
+var ExportFormats = []string{
+	EXPORT_FORMAT_SSH_CONFIG,
+	EXPORT_FORMAT_ANSIBLE_INI,
+	EXPORT_FORMAT_ANSIBLE_YAML,
+	EXPORT_FORMAT_JSON,
+}
+
+// exportForward is a local or remote port forward.
+// Local is the address of local side, and Remote is the address of remote side.
+type exportForward struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// exportServer is a server of json format.
+type exportServer struct {
+	Addr            string          `json:"addr"`
+	Port            string          `json:"port,omitempty"`
+	User            string          `json:"user,omitempty"`
+	IdentityFiles   []string        `json:"identity_files,omitempty"`
+	CertificateFile string          `json:"certificate_file,omitempty"`
+	PKCS11Provider  string          `json:"pkcs11_provider,omitempty"`
+	ProxyJump       []string        `json:"proxy_jump,omitempty"`
+	ProxyCommand    string          `json:"proxy_command,omitempty"`
+	LocalForwards   []exportForward `json:"local_forwards,omitempty"`
+	RemoteForwards  []exportForward `json:"remote_forwards,omitempty"`
+	DynamicForward  string          `json:"dynamic_forward,omitempty"`
+	ForwardAgent    bool            `json:"forward_agent,omitempty"`
+	ForwardX11      bool            `json:"forward_x11,omitempty"`
+	Note            string          `json:"note,omitempty"`
+	Tags            []string        `json:"tags,omitempty"`
+
+	// secrets
+	Pass        string `json:"pass,omitempty"`
+	KeyPass     string `json:"keypass,omitempty"`
+	CertKeyPass string `json:"certkeypass,omitempty"`
+	PKCS11PIN   string `json:"pkcs11pin,omitempty"`
+}
+
+// exporter is the state of Export.
+type exporter struct {
+	c          *Config
+	withSecret bool
+	warnings   []string
+}
+
+// Export render the servers in format, and return it with the warnings (settings that can not be exported).
+// If servers is empty, all servers are exported.
+func (c *Config) Export(format string, servers []string, withSecret bool) (data []byte, warnings []string, err error) {
+	// copy servers, to expand env and resolve secrets without changing c.
+	ec := *c
+	ec.Server = map[string]ServerConfig{}
+	for name, config := range c.Server {
+		expandEnvStruct(&config)
+		ec.Server[name] = config
+	}
+
+	e := &exporter{c: &ec, withSecret: withSecret}
+
+	if len(servers) == 0 {
+		servers = GetNameList(ec)
+	}
+	servers = common.GetUniqueSlice(servers)
+	sort.Strings(servers)
+
+	// run the secret commands
+	if withSecret {
+		for _, server := range servers {
+			if err := ec.ResolveServerConfig(server); err != nil {
+				e.warnf("%s", err)
+			}
+		}
+	}
+
+	switch format {
+	case EXPORT_FORMAT_SSH_CONFIG:
+		data = e.sshConfig(servers)
+	case EXPORT_FORMAT_ANSIBLE_INI:
+		data = e.ansibleINI(servers)
+	case EXPORT_FORMAT_ANSIBLE_YAML:
+		data, err = e.ansibleYAML(servers)
+	case EXPORT_FORMAT_JSON:
+		data, err = e.json(servers)
+	default:
+		err = fmt.Errorf("unknown export format: %s (%s)", format, strings.Join(ExportFormats, "|"))
+	}
+
+	return data, e.warnings, err
+}
+
+func (e *exporter) warnf(format string, a ...interface{}) {
+	e.warnings = append(e.warnings, fmt.Sprintf(format, a...))
+}
+
+// sshConfig render the servers in OpenSSH config format.
+// The ssh proxy servers are also exported, and used by ProxyJump with the server name.
+func (e *exporter) sshConfig(servers []string) []byte {
+	// add proxy servers
+	exported := map[string]bool{}
+	list := []string{}
+	for _, server := range servers {
+		name := server
+		for name != "" && !exported[name] {
+			if _, ok := e.c.Server[name]; !ok {
+				break
+			}
+			exported[name] = true
+			list = append(list, name)
+
+			s := e.c.Server[name]
+			if !isSSHProxyType(s.ProxyType) || (s.ProxyCommand != "" && s.ProxyCommand != "none") {
+				break
+			}
+			name = s.Proxy
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	for _, name := range list {
+		if strings.ContainsAny(name, " \t\"") {
+			e.warnf("%s: server name with space or quote can not be exported to %s", name, EXPORT_FORMAT_SSH_CONFIG)
+			continue
+		}
+
+		s := e.c.Server[name]
+
+		if s.Note != "" {
+			fmt.Fprintf(buf, "# %s\n", s.Note)
+		}
+		fmt.Fprintf(buf, "Host %s\n", name)
+
+		options := [][2]string{
+			{"HostName", s.Addr},
+			{"Port", s.Port},
+			{"User", s.User},
+		}
+
+		for _, key := range getExportIdentityFiles(s) {
+			options = append(options, [2]string{"IdentityFile", key})
+		}
+		if s.Cert != "" && !s.CertPKCS11 {
+			options = append(options, [2]string{"CertificateFile", s.Cert})
+		}
+		if s.PKCS11Use && s.PKCS11Provider != "" {
+			options = append(options, [2]string{"PKCS11Provider", s.PKCS11Provider})
+		}
+
+		// proxy
+		switch {
+		case s.ProxyCommand != "" && s.ProxyCommand != "none":
+			options = append(options, [2]string{"ProxyCommand", s.ProxyCommand})
+		case s.Proxy == "":
+		case isSSHProxyType(s.ProxyType):
+			options = append(options, [2]string{"ProxyJump", s.Proxy})
+		default:
+			if command, ok := e.proxyCommand(name, s.Proxy, s.ProxyType, EXPORT_FORMAT_SSH_CONFIG); ok {
+				options = append(options, [2]string{"ProxyCommand", command})
+			}
+		}
+
+		// forwarding
+		local, remote := e.getForwards(name, s)
+		for _, fw := range local {
+			options = append(options, [2]string{"LocalForward", fw.Local + " " + fw.Remote})
+		}
+		for _, fw := range remote {
+			options = append(options, [2]string{"RemoteForward", fw.Remote + " " + fw.Local})
+		}
+		options = append(options,
+			[2]string{"DynamicForward", s.DynamicPortForward},
+			[2]string{"RemoteForward", s.ReverseDynamicPortForward},
+		)
+		if s.SSHAgentUse {
+			options = append(options, [2]string{"ForwardAgent", "yes"})
+		}
+		if s.X11 {
+			options = append(options, [2]string{"ForwardX11", "yes"})
+		}
+		if s.X11Trusted {
+			options = append(options, [2]string{"ForwardX11Trusted", "yes"})
+		}
+
+		// connection
+		if s.ConnectTimeout > 0 {
+			options = append(options, [2]string{"ConnectTimeout", strconv.Itoa(s.ConnectTimeout)})
+		}
+		if s.ServerAliveCountInterval > 0 {
+			options = append(options, [2]string{"ServerAliveInterval", strconv.Itoa(s.ServerAliveCountInterval)})
+		}
+		if s.ServerAliveCountMax > 0 {
+			options = append(options, [2]string{"ServerAliveCountMax", strconv.Itoa(s.ServerAliveCountMax)})
+		}
+		options = append(options, [2]string{"StrictHostKeyChecking", s.StrictHostKeyChecking})
+		if len(s.KnownHostsFiles) > 0 {
+			options = append(options, [2]string{"UserKnownHostsFile", strings.Join(s.KnownHostsFiles, " ")})
+		}
+
+		for _, o := range options {
+			if o[1] != "" {
+				fmt.Fprintf(buf, "    %s %s\n", o[0], o[1])
+			}
+		}
+		fmt.Fprintln(buf)
+	}
+
+	return buf.Bytes()
+}
+
+// ansibleHostVars return the host variables of ansible inventory, and the order of keys.
+func (e *exporter) ansibleHostVars(name string) (vars map[string]string, keys []string) {
+	s := e.c.Server[name]
+	vars = map[string]string{}
+
+	set := func(key, value string) {
+		if value != "" {
+			vars[key] = value
+			keys = append(keys, key)
+		}
+	}
+
+	set("ansible_host", s.Addr)
+	set("ansible_port", s.Port)
+	set("ansible_user", s.User)
+
+	keyFiles := getExportIdentityFiles(s)
+	if len(keyFiles) > 0 {
+		set("ansible_ssh_private_key_file", keyFiles[0])
+	}
+
+	// ssh args
+	args := []string{}
+	jumps, command := e.proxyRoute(name, EXPORT_FORMAT_ANSIBLE_INI)
+	if len(jumps) > 0 {
+		args = append(args, "-o ProxyJump="+strings.Join(jumps, ","))
+	}
+	if command != "" {
+		args = append(args, "-o 'ProxyCommand="+strings.Replace(command, "'", `'"'"'`, -1)+"'")
+	}
+	if s.StrictHostKeyChecking != "" {
+		args = append(args, "-o StrictHostKeyChecking="+s.StrictHostKeyChecking)
+	}
+	set("ansible_ssh_common_args", strings.Join(args, " "))
+
+	if e.withSecret {
+		pass := s.Pass
+		if pass == "" && len(s.Passes) > 0 {
+			pass = s.Passes[0]
+		}
+		set("ansible_password", pass)
+	}
+
+	return
+}
+
+// ansibleGroups return the groups (and tags) of ansible inventory, that have servers.
+func (e *exporter) ansibleGroups(servers []string) (groups map[string][]string, names []string) {
+	groups = map[string][]string{}
+	for _, name := range e.c.GetGroupNameList() {
+		members := []string{}
+		for _, m := range e.c.GetGroupMembers(name) {
+			if common.Contains(servers, m) {
+				members = append(members, m)
+			}
+		}
+
+		if len(members) > 0 {
+			groups[name] = members
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+// ansibleINI render the servers in ansible inventory (INI) format.
+func (e *exporter) ansibleINI(servers []string) []byte {
+	buf := new(bytes.Buffer)
+
+	fmt.Fprintln(buf, "[all]")
+	for _, name := range servers {
+		vars, keys := e.ansibleHostVars(name)
+
+		line := []string{name}
+		for _, key := range keys {
+			value := vars[key]
+			if strings.ContainsAny(value, " \t\"'\\=") {
+				value = strconv.Quote(value)
+			}
+			line = append(line, key+"="+value)
+		}
+		fmt.Fprintln(buf, strings.Join(line, " "))
+	}
+
+	groups, names := e.ansibleGroups(servers)
+	for _, name := range names {
+		fmt.Fprintf(buf, "\n[%s]\n", name)
+		for _, member := range groups[name] {
+			fmt.Fprintln(buf, member)
+		}
+	}
+
+	return buf.Bytes()
+}
+
+// ansibleYAML render the servers in ansible inventory (YAML) format.
+func (e *exporter) ansibleYAML(servers []string) ([]byte, error) {
+	hosts := map[string]interface{}{}
+	for _, name := range servers {
+		vars, _ := e.ansibleHostVars(name)
+
+		hostVars := map[string]interface{}{}
+		for key, value := range vars {
+			hostVars[key] = value
+			if port, err := strconv.Atoi(value); err == nil && key == "ansible_port" {
+				hostVars[key] = port
+			}
+		}
+		hosts[name] = hostVars
+	}
+
+	all := map[string]interface{}{"hosts": hosts}
+
+	groups, names := e.ansibleGroups(servers)
+	if len(names) > 0 {
+		children := map[string]interface{}{}
+		for _, name := range names {
+			members := map[string]interface{}{}
+			for _, member := range groups[name] {
+				members[member] = map[string]interface{}{}
+			}
+			children[name] = map[string]interface{}{"hosts": members}
+		}
+		all["children"] = children
+	}
+
+	return yaml.Marshal(map[string]interface{}{"all": all})
+}
+
+// json render the servers and groups in JSON format.
+func (e *exporter) json(servers []string) ([]byte, error) {
+	result := struct {
+		Servers map[string]exportServer `json:"servers"`
+		Groups  map[string][]string     `json:"groups,omitempty"`
+	}{
+		Servers: map[string]exportServer{},
+	}
+
+	for _, name := range servers {
+		s := e.c.Server[name]
+
+		es := exportServer{
+			Addr:           s.Addr,
+			Port:           s.Port,
+			User:           s.User,
+			IdentityFiles:  getExportIdentityFiles(s),
+			DynamicForward: s.DynamicPortForward,
+			ForwardAgent:   s.SSHAgentUse,
+			ForwardX11:     s.X11,
+			Note:           s.Note,
+			Tags:           s.Tags,
+		}
+		if !s.CertPKCS11 {
+			es.CertificateFile = s.Cert
+		}
+		if s.PKCS11Use {
+			es.PKCS11Provider = s.PKCS11Provider
+		}
+		es.ProxyJump, es.ProxyCommand = e.proxyRoute(name, EXPORT_FORMAT_JSON)
+		es.LocalForwards, es.RemoteForwards = e.getForwards(name, s)
+
+		if e.withSecret {
+			es.Pass = s.Pass
+			if es.Pass == "" && len(s.Passes) > 0 {
+				es.Pass = s.Passes[0]
+			}
+			es.KeyPass = s.KeyPass
+			es.CertKeyPass = s.CertKeyPass
+			es.PKCS11PIN = s.PKCS11PIN
+		}
+
+		result.Servers[name] = es
+	}
+
+	groups, _ := e.ansibleGroups(servers)
+	if len(groups) > 0 {
+		result.Groups = groups
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append(data, '\n'), nil
+}
+
+// proxyRoute return the proxy route of server, for the format without server name (ansible and json).
+// jumps is the ssh proxy servers (`[user@]addr[:port]`) in order of connection.
+// If the route can not be exported, it returns empty and add warning.
+func (e *exporter) proxyRoute(server, format string) (jumps []string, command string) {
+	name := server
+	s := e.c.Server[server]
+	visited := map[string]bool{server: true}
+
+	for {
+		switch {
+		case s.ProxyCommand != "" && s.ProxyCommand != "none":
+			command = s.ProxyCommand
+		case s.Proxy == "":
+		case isSSHProxyType(s.ProxyType):
+			p, ok := e.c.Server[s.Proxy]
+			if !ok || visited[s.Proxy] {
+				e.warnf("%s: proxy route can not be exported to %s", server, format)
+				return nil, ""
+			}
+			visited[s.Proxy] = true
+
+			jumps = append([]string{getJumpSpec(p)}, jumps...)
+			name, s = s.Proxy, p
+			continue
+		default:
+			var ok bool
+			command, ok = e.proxyCommand(name, s.Proxy, s.ProxyType, format)
+			if !ok {
+				return nil, ""
+			}
+		}
+
+		break
+	}
+
+	// ProxyJump and ProxyCommand can not be used together.
+	if len(jumps) > 0 && command != "" {
+		e.warnf("%s: proxy route via %s and proxy command can not be exported to %s", server, name, format)
+		return nil, ""
+	}
+
+	return
+}
+
+// proxyCommand return the netcat command of http or socks5 proxy.
+func (e *exporter) proxyCommand(server, proxy, proxyType, format string) (command string, ok bool) {
+	p, ok := e.c.Proxy[proxy]
+	if !ok || p.Proxy != "" {
+		e.warnf("%s: proxy route via %s can not be exported to %s", server, proxy, format)
+		return "", false
+	}
+
+	mode := "connect"
+	if proxyType == "socks" || proxyType == "socks5" {
+		mode = "5"
+	}
+
+	command = fmt.Sprintf("nc -X %s -x %s", mode, net.JoinHostPort(p.Addr, p.Port))
+	if p.User != "" {
+		command += " -P " + p.User
+	}
+
+	return command + " %h %p", true
+}
+
+// getForwards return the local and remote port forwards of server.
+func (e *exporter) getForwards(name string, s ServerConfig) (local, remote []exportForward) {
+	forwards := s.PortForwards
+	if s.PortForwardLocal != "" && s.PortForwardRemote != "" {
+		mode := s.PortForwardMode
+		if mode == "" {
+			mode = "L"
+		}
+		forwards = append([]string{mode + ":" + s.PortForwardLocal + ":" + s.PortForwardRemote}, forwards...)
+	}
+
+	for _, value := range forwards {
+		fw, err := ParsePortForward(value)
+		if err != nil {
+			e.warnf("%s: %s", name, err)
+			continue
+		}
+
+		switch fw.Mode {
+		case "L":
+			local = append(local, exportForward{Local: fw.Local, Remote: fw.Remote})
+		case "R":
+			remote = append(remote, exportForward{Local: fw.Local, Remote: fw.Remote})
+		}
+	}
+
+	return
+}
+
+// getExportIdentityFiles return the key files of server (certkey, key and keys).
+// The passphrase of keys ("keypath::passphrase") is removed.
+func getExportIdentityFiles(s ServerConfig) (files []string) {
+	keys := []string{}
+	if s.Cert != "" && !s.CertPKCS11 {
+		keys = append(keys, s.CertKey)
+	}
+	keys = append(keys, s.Key)
+	for _, key := range s.Keys {
+		keys = append(keys, strings.SplitN(key, "::", 2)[0])
+	}
+
+	for _, key := range keys {
+		if key != "" && !common.Contains(files, key) {
+			files = append(files, key)
+		}
+	}
+
+	return
+}
+
+// getJumpSpec return the ProxyJump host `[user@]addr[:port]` of server.
+func getJumpSpec(s ServerConfig) (spec string) {
+	spec = s.Addr
+	if strings.Contains(spec, ":") {
+		spec = "[" + spec + "]"
+	}
+	if s.Port != "" && s.Port != "22" {
+		spec = net.JoinHostPort(s.Addr, s.Port)
+	}
+	if s.User != "" {
+		spec = s.User + "@" + spec
+	}
+
+	return
+}
+
+// isSSHProxyType returns true if proxyType is ssh (or empty).
+func isSSHProxyType(proxyType string) bool {
+	switch proxyType {
+	case "http", "https", "socks", "socks5":
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,219 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package conf
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// GroupPrefix is the prefix of group (or tag) name in host list.
+// ex.) `lssh -H @web`
+const GroupPrefix = "@"
+
+// isGroupMember returns true if server belongs to group (or tag) name.
+func isGroupMember(name, server string, serverConfig ServerConfig, group GroupConfig) bool {
+	for _, s := range group.Servers {
+		if s == server {
+			return true
+		}
+	}
+
+	for _, tag := range serverConfig.Tags {
+		if tag == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reduceGroup returns the server config, that is set the settings of groups the server belongs to.
+// If the server belongs to multiple groups, groups are applied in order of name.
+func (c *Config) reduceGroup(server string, serverConfig ServerConfig) ServerConfig {
+	// tags are inherited from common, same as other settings.
+	tagConfig := serverConfig
+	if len(tagConfig.Tags) == 0 {
+		tagConfig.Tags = c.Common.Tags
+	}
+
+	names := []string{}
+	for name := range c.Group {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		group := c.Group[name]
+		if !isGroupMember(name, server, tagConfig, group) {
+			continue
+		}
+
+		// note and tags are not inherited from group.
+		groupConfig := group.ServerConfig
+		groupConfig.Note = ""
+		groupConfig.Tags = nil
+
+		serverConfig = serverConfigReduct(groupConfig, serverConfig)
+	}
+
+	return serverConfig
+}
+
+// GetGroupMembers return the sorted server names of group (or tag) name.
+func (c *Config) GetGroupMembers(name string) (members []string) {
+	group := c.Group[name]
+	for server, serverConfig := range c.Server {
+		if isGroupMember(name, server, serverConfig, group) {
+			members = append(members, server)
+		}
+	}
+	sort.Strings(members)
+
+	return
+}
+
+// GetGroupNameList return the sorted list of group and tag names, that have members.
+func (c *Config) GetGroupNameList() (nameList []string) {
+	names := []string{}
+	for name := range c.Group {
+		names = append(names, name)
+	}
+	for _, serverConfig := range c.Server {
+		names = append(names, serverConfig.Tags...)
+	}
+	names = common.GetUniqueSlice(names)
+	sort.Strings(names)
+
+	for _, name := range names {
+		if len(c.GetGroupMembers(name)) > 0 {
+			nameList = append(nameList, name)
+		}
+	}
+
+	return
+}
+
+// ExpandHosts replace `@<group>` in hosts with the member servers of group (or tag),
+// and the patterns (glob or `/regex/`) with the matched servers (sorted by name).
+// Duplicate servers are removed.
+func (c *Config) ExpandHosts(hosts []string) (result []string, err error) {
+	for _, host := range hosts {
+		var members []string
+		members, err = c.expandHost(host)
+		if err != nil {
+			return
+		}
+
+		if members == nil {
+			result = append(result, host)
+			continue
+		}
+
+		if len(members) == 0 {
+			err = fmt.Errorf("no server matches %s", host)
+			return
+		}
+
+		result = append(result, members...)
+	}
+
+	result = common.GetUniqueSlice(result)
+
+	return
+}
+
+// ExcludeHosts remove excludes from hosts. excludes can be server names, `@<group>` and patterns (glob or `/regex/`).
+func (c *Config) ExcludeHosts(hosts, excludes []string) (result []string, err error) {
+	excluded := map[string]bool{}
+	for _, exclude := range excludes {
+		var members []string
+		members, err = c.expandHost(exclude)
+		if err != nil {
+			return
+		}
+
+		if members == nil {
+			members = []string{exclude}
+		}
+
+		for _, m := range members {
+			excluded[m] = true
+		}
+	}
+
+	result = []string{}
+	for _, host := range hosts {
+		if !excluded[host] {
+			result = append(result, host)
+		}
+	}
+
+	return
+}
+
+// expandHost returns the servers of `@<group>` or pattern host.
+// If host is a server name, it returns nil.
+func (c *Config) expandHost(host string) (members []string, err error) {
+	switch {
+	case strings.HasPrefix(host, GroupPrefix):
+		name := strings.TrimPrefix(host, GroupPrefix)
+		members = c.GetGroupMembers(name)
+		if len(members) == 0 {
+			err = fmt.Errorf("group or tag %s is not found", host)
+		}
+
+	case IsHostPattern(host):
+		names := GetNameList(*c)
+		sort.Strings(names)
+
+		members = []string{}
+		for _, name := range names {
+			var ok bool
+			ok, err = MatchHostPattern(host, name)
+			if err != nil {
+				return
+			}
+			if ok {
+				members = append(members, name)
+			}
+		}
+	}
+
+	return
+}
+
+// IsHostPattern returns true if host is a pattern, `/regex/` or glob (contains `*`, `?` or `[`).
+func IsHostPattern(host string) bool {
+	if len(host) > 1 && strings.HasPrefix(host, "/") && strings.HasSuffix(host, "/") {
+		return true
+	}
+
+	return strings.ContainsAny(host, "*?[")
+}
+
+// MatchHostPattern returns true if name matches pattern (`/regex/` or glob).
+func MatchHostPattern(pattern, name string) (bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false, fmt.Errorf("invalid regex %s: %s", pattern, err)
+		}
+
+		return re.MatchString(name), nil
+	}
+
+	ok, err := path.Match(pattern, name)
+	if err != nil {
+		return false, fmt.Errorf("invalid pattern %s: %s", pattern, err)
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,209 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code to read the include files ([include] and [includes]).
+//
+// Include files are read in the following order, and each file is read only once.
+//   - [include] sorted by name, then [includes].path in order.
+//   - Glob pattern is expanded in lexical order.
+//   - Include files of an include file are read just after it (depth first).
+//     Relative path in an include file is from the directory of the file.
+//
+// If the same name of server, proxy or group is defined in multiple files,
+// the one read later is used (the main config file is read first).
+
+package conf
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+)
+
+// includeFile is a read include file.
+type includeFile struct {
+	Path   string
+	Config Config
+
+	// Common is the common setting of this file, merged with the common settings of parents.
+	Common ServerConfig
+}
+
+// ReadIncludeFiles read include files and append to Config.Server.
+func (c *Config) ReadIncludeFiles() {
+	err := c.readIncludeSettings()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "err: Read config file error: %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, f := range c.includeFiles {
+		// add include file serverconf
+		for key, value := range f.Config.Server {
+			// reduce group and common setting
+			value = c.reduceGroup(key, value)
+			setValue := serverConfigReduct(f.Common, value)
+			c.Server[key] = setValue
+			c.setServerSource(key, f.Path)
+		}
+	}
+}
+
+// readIncludeSettings read include files, and merge [proxy], [group], [sshconfig], [inventory] and [dynamic] of them to c.
+// It is called before reducing servers, so that the groups in include files are applied to all servers.
+// If include files are already read, it does nothing.
+func (c *Config) readIncludeSettings() (err error) {
+	if c.includeRead {
+		return
+	}
+
+	files := []includeFile{}
+	err = loadIncludeFiles(c.getIncludePaths(), "", c.Common, []string{}, map[string]bool{}, &files)
+	if err != nil {
+		return
+	}
+
+	c.includeFiles = files
+	c.includeRead = true
+
+	for _, f := range files {
+		for key, value := range f.Config.Proxy {
+			if c.Proxy == nil {
+				c.Proxy = map[string]ProxyConfig{}
+			}
+			c.Proxy[key] = value
+		}
+
+		for key, value := range f.Config.Group {
+			if c.Group == nil {
+				c.Group = map[string]GroupConfig{}
+			}
+			c.Group[key] = value
+		}
+
+		for key, value := range f.Config.SSHConfig {
+			if c.SSHConfig == nil {
+				c.SSHConfig = map[string]OpenSSHConfig{}
+			}
+
+			// apply common setting of include file
+			value.ServerConfig = serverConfigReduct(f.Common, value.ServerConfig)
+			c.SSHConfig[key] = value
+		}
+
+		for key, value := range f.Config.Inventory {
+			if c.Inventory == nil {
+				c.Inventory = map[string]InventoryConfig{}
+			}
+
+			// apply common setting of include file
+			value.ServerConfig = serverConfigReduct(f.Common, value.ServerConfig)
+			c.Inventory[key] = value
+		}
+
+		for key, value := range f.Config.Dynamic {
+			if c.Dynamic == nil {
+				c.Dynamic = map[string]DynamicConfig{}
+			}
+
+			// apply common setting of include file
+			value.ServerConfig = serverConfigReduct(f.Common, value.ServerConfig)
+			c.Dynamic[key] = value
+		}
+	}
+
+	return
+}
+
+// loadIncludeFiles read the include files of patterns recursively, and append to files.
+// dir is the directory of the parent include file ("" is the main config file).
+// stack is the include files being read, used to detect include loop.
+func loadIncludeFiles(patterns []string, dir string, parentCommon ServerConfig, stack []string, read map[string]bool, files *[]includeFile) error {
+	for _, pattern := range patterns {
+		paths, err := expandIncludePath(pattern, dir)
+		if err != nil {
+			return err
+		}
+
+		for _, path := range paths {
+			if common.Contains(stack, path) {
+				return fmt.Errorf("include loop: %s -> %s", strings.Join(stack, " -> "), path)
+			}
+
+			if read[path] {
+				continue
+			}
+			read[path] = true
+
+			var includeConf Config
+			err = decodeFile(path, &includeConf)
+			if err != nil {
+				return fmt.Errorf("%s: %s", path, err)
+			}
+
+			// reduce common setting
+			setCommon := serverConfigReduct(parentCommon, includeConf.Common)
+
+			*files = append(*files, includeFile{Path: path, Config: includeConf, Common: setCommon})
+
+			// nested include files
+			nestedStack := append(stack[:len(stack):len(stack)], path)
+			err = loadIncludeFiles(includeConf.getIncludePaths(), filepath.Dir(path), setCommon, nestedStack, read, files)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// expandIncludePath return the full paths of include path pattern.
+// If pattern is a glob pattern, it returns the matched files in lexical order (can be empty).
+func expandIncludePath(pattern, dir string) (paths []string, err error) {
+	if dir != "" && !strings.HasPrefix(pattern, "~") && !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	pattern = common.GetFullPath(pattern)
+
+	if !strings.ContainsAny(pattern, "*?[") {
+		return []string{pattern}, nil
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("include path %s: %s", pattern, err)
+	}
+	sort.Strings(matches)
+
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && !info.IsDir() {
+			paths = append(paths, common.GetFullPath(m))
+		}
+	}
+
+	return
+}
+
+// getIncludePaths return the include path patterns of [include] and [includes].
+// [include] is sorted by name, and [includes] is in order of path.
+func (c *Config) getIncludePaths() (paths []string) {
+	names := []string{}
+	for name := range c.Include {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		paths = append(paths, c.Include[name].Path)
+	}
+
+	paths = append(paths, c.Includes.Path...)
+
+	return
+}
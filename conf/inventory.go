@@ -0,0 +1,737 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code to import the Ansible inventory ([inventory.<name>]).
+// INI and YAML inventory files, and JSON output of dynamic inventory script are supported.
+
+package conf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/kballard/go-shellquote"
+	"gopkg.in/yaml.v3"
+)
+
+// inventoryGroup is a group of Ansible inventory.
+type inventoryGroup struct {
+	Hosts    []string
+	Children []string
+	Vars     map[string]string
+}
+
+// ansibleInventory is the parsed Ansible inventory.
+type ansibleInventory struct {
+	// host vars, and the order of hosts.
+	Hosts     map[string]map[string]string
+	HostOrder []string
+
+	Groups map[string]*inventoryGroup
+
+	// cache of getGroupDepth and getHostVars
+	depth   map[string]int
+	members map[string][]string
+}
+
+// inventoryYAMLGroup is a group of YAML inventory.
+type inventoryYAMLGroup struct {
+	Hosts    map[string]map[string]interface{} `yaml:"hosts"`
+	Vars     map[string]interface{}            `yaml:"vars"`
+	Children map[string]*inventoryYAMLGroup    `yaml:"children"`
+}
+
+// inventoryJSONGroup is a group of dynamic inventory JSON.
+type inventoryJSONGroup struct {
+	Hosts    []string               `json:"hosts"`
+	Vars     map[string]interface{} `json:"vars"`
+	Children []string               `json:"children"`
+}
+
+// ReadInventory read Ansible inventories, and append to Config.Server and Config.Group.
+// The groups of inventory are added to Config.Group (merged if the same name exists).
+func (c *Config) ReadInventory() {
+	for _, name := range c.getInventoryNames() {
+		ic := c.Inventory[name]
+
+		servers, groups, err := getInventoryConfig(name, ic.Path, ic.Command)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: inventory.%s: %s\n", name, err)
+			continue
+		}
+
+		c.addInventory(ic, servers, groups)
+		for key := range servers {
+			c.setServerSource(key, getSourceText("inventory."+name, ic.Path, ic.Command))
+		}
+	}
+}
+
+// addInventory append servers and groups of inventory to c.
+func (c *Config) addInventory(ic InventoryConfig, servers map[string]ServerConfig, groups map[string][]string) {
+	if c.Group == nil {
+		c.Group = map[string]GroupConfig{}
+	}
+
+	// groups are added first, so that [group.<name>] settings are applied to the inventory hosts.
+	for name, members := range groups {
+		group := c.Group[name]
+		for _, m := range members {
+			if !common.Contains(group.Servers, m) {
+				group.Servers = append(group.Servers, m)
+			}
+		}
+		c.Group[name] = group
+	}
+
+	setCommon := serverConfigReduct(c.Common, ic.ServerConfig)
+	for key, value := range servers {
+		value = c.reduceGroup(key, value)
+		value = serverConfigReduct(setCommon, value)
+
+		// like ansible, the local user is used if user is not set.
+		if value.User == "" {
+			value.User = getLocalUser()
+		}
+
+		c.Server[key] = value
+	}
+}
+
+// getInventoryNames return the names of [inventory] in sorted order.
+func (c *Config) getInventoryNames() (names []string) {
+	for name := range c.Inventory {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// getInventoryConfig read the Ansible inventory, and return the servers and groups.
+// The server name is `<name>:<host>`.
+func getInventoryConfig(name, path, command string) (servers map[string]ServerConfig, groups map[string][]string, err error) {
+	inv, err := readInventory(path, command)
+	if err != nil {
+		return
+	}
+
+	servers = map[string]ServerConfig{}
+	groups = map[string][]string{}
+
+	prefix := name + ":"
+	note := "from:inventory." + name
+
+	for _, host := range inv.HostOrder {
+		vars := inv.getHostVars(host)
+		server := ServerConfig{
+			Addr: host,
+			Note: note,
+		}
+
+		for _, key := range []string{"ansible_host", "ansible_ssh_host"} {
+			if v, ok := vars[key]; ok && v != "" {
+				server.Addr = v
+				break
+			}
+		}
+		for _, key := range []string{"ansible_port", "ansible_ssh_port"} {
+			if v, ok := vars[key]; ok && v != "" {
+				server.Port = v
+				break
+			}
+		}
+		for _, key := range []string{"ansible_user", "ansible_ssh_user"} {
+			if v, ok := vars[key]; ok && v != "" {
+				server.User = v
+				break
+			}
+		}
+		if v := vars["ansible_ssh_private_key_file"]; v != "" {
+			server.Key = common.GetFullPath(v)
+		}
+
+		// ProxyJump and ProxyCommand in ssh args
+		args := strings.TrimSpace(vars["ansible_ssh_common_args"] + " " + vars["ansible_ssh_extra_args"])
+		jump, proxyCommand := parseInventorySSHArgs(args)
+		if proxyCommand != "" {
+			server.ProxyCommand = proxyCommand
+		}
+		if jump != "" {
+			server.Proxy = addInventoryJumps(inv, prefix, note, strings.Split(jump, ","), servers)
+			server.ProxyCommand = ""
+		}
+
+		servers[prefix+host] = server
+	}
+
+	for groupName := range inv.Groups {
+		if groupName == "all" || groupName == "ungrouped" {
+			continue
+		}
+
+		members := []string{}
+		for _, host := range inv.getGroupHosts(groupName, map[string]bool{}) {
+			members = append(members, prefix+host)
+		}
+		sort.Strings(members)
+
+		if len(members) > 0 {
+			groups[groupName] = common.GetUniqueSlice(members)
+		}
+	}
+
+	return
+}
+
+// addInventoryJumps add the ProxyJump hosts to servers, and return the server name of the last jump host.
+// If the jump host is a host of the inventory, it is used.
+func addInventoryJumps(inv *ansibleInventory, prefix, note string, jumps []string, servers map[string]ServerConfig) (name string) {
+	prev := ""
+	for _, spec := range jumps {
+		jumpUser, host, port := parseOpenSSHJump(strings.TrimSpace(spec))
+
+		_, isInventoryHost := inv.Hosts[host]
+		if isInventoryHost && jumpUser == "" && port == "" && prev == "" {
+			name = prefix + host
+		} else {
+			name = prefix + spec
+			if prev != "" {
+				name = prev + ">" + spec
+			}
+
+			servers[name] = ServerConfig{
+				Addr:  host,
+				Port:  port,
+				User:  jumpUser,
+				Proxy: prev,
+				Note:  note + " (ProxyJump)",
+			}
+		}
+
+		prev = name
+	}
+
+	return
+}
+
+// parseInventorySSHArgs return ProxyJump and ProxyCommand in ssh args (`-J`, `-o ProxyJump=`, `-o ProxyCommand=`).
+func parseInventorySSHArgs(args string) (jump, proxyCommand string) {
+	words, err := shellquote.Split(args)
+	if err != nil {
+		return
+	}
+
+	for i := 0; i < len(words); i++ {
+		var option string
+		switch {
+		case words[i] == "-J" && i+1 < len(words):
+			i++
+			jump = words[i]
+			continue
+		case strings.HasPrefix(words[i], "-J"):
+			jump = strings.TrimPrefix(words[i], "-J")
+			continue
+		case words[i] == "-o" && i+1 < len(words):
+			i++
+			option = words[i]
+		case strings.HasPrefix(words[i], "-o"):
+			option = strings.TrimPrefix(words[i], "-o")
+		default:
+			continue
+		}
+
+		key, value, err := parseOpenSSHOption(option)
+		if err != nil {
+			continue
+		}
+
+		switch key {
+		case "proxyjump":
+			jump = value
+		case "proxycommand":
+			proxyCommand = value
+		}
+	}
+
+	return
+}
+
+// parseOpenSSHOption parse the `-o` option of ssh (`Key=Value` or `Key Value`).
+func parseOpenSSHOption(option string) (key, value string, err error) {
+	key, args, err := parseOpenSSHLine(option)
+	if err != nil || key == "" {
+		return "", "", fmt.Errorf("invalid option: %s", option)
+	}
+
+	return key, strings.Join(args, " "), nil
+}
+
+// readInventory read the Ansible inventory file (INI, YAML or JSON), or the output of command (JSON).
+func readInventory(path, command string) (inv *ansibleInventory, err error) {
+	var data []byte
+	switch {
+	case path != "": // 1st
+		path = common.GetFullPath(path)
+		data, err = os.ReadFile(path)
+	case command != "": // 2nd
+		data, err = exec.Command("sh", "-c", command).Output()
+		path = ""
+	default:
+		err = fmt.Errorf("path or command is not set")
+	}
+	if err != nil {
+		return
+	}
+
+	inv = &ansibleInventory{
+		Hosts:  map[string]map[string]string{},
+		Groups: map[string]*inventoryGroup{},
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case ext == ".yaml" || ext == ".yml":
+		err = inv.parseYAML(data)
+	case ext == ".json" || bytes.HasPrefix(trimmed, []byte("{")):
+		err = inv.parseJSON(data)
+	default:
+		err = inv.parseINI(data)
+	}
+
+	return
+}
+
+// group return the group of name. If not exist, it is created.
+func (inv *ansibleInventory) group(name string) *inventoryGroup {
+	g, ok := inv.Groups[name]
+	if !ok {
+		g = &inventoryGroup{Vars: map[string]string{}}
+		inv.Groups[name] = g
+	}
+
+	return g
+}
+
+// addHost add host (with vars) to group.
+func (inv *ansibleInventory) addHost(group, host string, vars map[string]string) {
+	if _, ok := inv.Hosts[host]; !ok {
+		inv.Hosts[host] = map[string]string{}
+		inv.HostOrder = append(inv.HostOrder, host)
+	}
+	for k, v := range vars {
+		inv.Hosts[host][k] = v
+	}
+
+	g := inv.group(group)
+	if !common.Contains(g.Hosts, host) {
+		g.Hosts = append(g.Hosts, host)
+	}
+}
+
+// addChild add child group to group.
+func (inv *ansibleInventory) addChild(group, child string) {
+	inv.group(child)
+
+	g := inv.group(group)
+	if !common.Contains(g.Children, child) {
+		g.Children = append(g.Children, child)
+	}
+}
+
+// getGroupHosts return the hosts of group, including the hosts of child groups.
+func (inv *ansibleInventory) getGroupHosts(name string, visited map[string]bool) (hosts []string) {
+	g, ok := inv.Groups[name]
+	if !ok || visited[name] {
+		return
+	}
+	visited[name] = true
+
+	hosts = append(hosts, g.Hosts...)
+	for _, child := range g.Children {
+		hosts = append(hosts, inv.getGroupHosts(child, visited)...)
+	}
+
+	return
+}
+
+// getGroupDepth return the depth of group from `all` (all is 0, top level groups are 1).
+func (inv *ansibleInventory) getGroupDepth(name string) int {
+	if inv.depth != nil {
+		return inv.depth[name]
+	}
+
+	depth := map[string]int{"all": 0}
+
+	// breadth first search from the top level groups
+	queue := []string{}
+	for groupName := range inv.Groups {
+		if groupName == "all" {
+			continue
+		}
+		if !inv.isChild(groupName) || common.Contains(inv.group("all").Children, groupName) {
+			depth[groupName] = 1
+			queue = append(queue, groupName)
+		}
+	}
+	sort.Strings(queue)
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for _, child := range inv.Groups[current].Children {
+			if _, ok := depth[child]; !ok {
+				depth[child] = depth[current] + 1
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	inv.depth = depth
+	return depth[name]
+}
+
+// isChild returns true if the group is a child of other group.
+func (inv *ansibleInventory) isChild(name string) bool {
+	for _, g := range inv.Groups {
+		if common.Contains(g.Children, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getHostVars return the vars of host.
+// The vars of groups are applied in order of depth (parent first) and name, and the host vars have the highest priority.
+func (inv *ansibleInventory) getHostVars(host string) (vars map[string]string) {
+	vars = map[string]string{}
+
+	if inv.members == nil {
+		inv.members = map[string][]string{}
+		for name := range inv.Groups {
+			inv.members[name] = inv.getGroupHosts(name, map[string]bool{})
+		}
+	}
+
+	groups := []string{}
+	for name := range inv.Groups {
+		if name == "all" || common.Contains(inv.members[name], host) {
+			groups = append(groups, name)
+		}
+	}
+
+	depth := map[string]int{}
+	for _, name := range groups {
+		depth[name] = inv.getGroupDepth(name)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if depth[groups[i]] != depth[groups[j]] {
+			return depth[groups[i]] < depth[groups[j]]
+		}
+		return groups[i] < groups[j]
+	})
+
+	for _, name := range groups {
+		for k, v := range inv.Groups[name].Vars {
+			vars[k] = v
+		}
+	}
+
+	for k, v := range inv.Hosts[host] {
+		vars[k] = v
+	}
+
+	return
+}
+
+// parseINI parse the INI inventory.
+func (inv *ansibleInventory) parseINI(data []byte) (err error) {
+	section, sectionType := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		// section
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			sectionType = "hosts"
+			if i := strings.LastIndex(section, ":"); i >= 0 {
+				section, sectionType = section[:i], section[i+1:]
+			}
+			inv.group(section)
+			continue
+		}
+
+		switch sectionType {
+		case "hosts":
+			words, err := shellquote.Split(line)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", lineNum, err)
+			}
+
+			vars := map[string]string{}
+			for _, w := range words[1:] {
+				if strings.HasPrefix(w, "#") {
+					break
+				}
+				kv := strings.SplitN(w, "=", 2)
+				if len(kv) != 2 {
+					return fmt.Errorf("line %d: invalid host variable: %s", lineNum, w)
+				}
+				vars[kv[0]] = kv[1]
+			}
+
+			host := words[0]
+			if h, port, ok := splitInventoryHostPort(host); ok {
+				host = h
+				if _, exist := vars["ansible_port"]; !exist {
+					vars["ansible_port"] = port
+				}
+			}
+
+			for _, h := range expandInventoryHostRange(host) {
+				inv.addHost(section, h, vars)
+			}
+
+		case "vars":
+			kv := strings.SplitN(line, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("line %d: invalid group variable: %s", lineNum, line)
+			}
+			inv.group(section).Vars[strings.TrimSpace(kv[0])] = unquoteInventoryValue(strings.TrimSpace(kv[1]))
+
+		case "children":
+			inv.addChild(section, line)
+
+		default:
+			return fmt.Errorf("line %d: unknown section type: %s", lineNum, sectionType)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseYAML parse the YAML inventory.
+func (inv *ansibleInventory) parseYAML(data []byte) (err error) {
+	groups := map[string]*inventoryYAMLGroup{}
+	err = yaml.Unmarshal(data, &groups)
+	if err != nil {
+		return
+	}
+
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		inv.addYAMLGroup(name, groups[name], map[*inventoryYAMLGroup]bool{})
+	}
+
+	return
+}
+
+// addYAMLGroup add the group of YAML inventory recursively.
+func (inv *ansibleInventory) addYAMLGroup(name string, g *inventoryYAMLGroup, visited map[*inventoryYAMLGroup]bool) {
+	group := inv.group(name)
+	if g == nil || visited[g] {
+		return
+	}
+	visited[g] = true
+
+	for k, v := range g.Vars {
+		group.Vars[k] = fmt.Sprint(v)
+	}
+
+	hosts := []string{}
+	for host := range g.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		vars := map[string]string{}
+		for k, v := range g.Hosts[host] {
+			vars[k] = fmt.Sprint(v)
+		}
+
+		for _, h := range expandInventoryHostRange(host) {
+			inv.addHost(name, h, vars)
+		}
+	}
+
+	children := []string{}
+	for child := range g.Children {
+		children = append(children, child)
+	}
+	sort.Strings(children)
+
+	for _, child := range children {
+		inv.addChild(name, child)
+		inv.addYAMLGroup(child, g.Children[child], visited)
+	}
+}
+
+// parseJSON parse the JSON of dynamic inventory (`--list` output).
+func (inv *ansibleInventory) parseJSON(data []byte) (err error) {
+	raw := map[string]json.RawMessage{}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return
+	}
+
+	// host vars
+	meta := struct {
+		HostVars map[string]map[string]interface{} `json:"hostvars"`
+	}{}
+	if m, ok := raw["_meta"]; ok {
+		err = json.Unmarshal(m, &meta)
+		if err != nil {
+			return
+		}
+	}
+
+	names := []string{}
+	for name := range raw {
+		if name != "_meta" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		g := inventoryJSONGroup{}
+
+		// group is a list of hosts, or an object.
+		if err := json.Unmarshal(raw[name], &g.Hosts); err != nil {
+			err = json.Unmarshal(raw[name], &g)
+			if err != nil {
+				return fmt.Errorf("group %s: %s", name, err)
+			}
+		}
+
+		group := inv.group(name)
+		for k, v := range g.Vars {
+			group.Vars[k] = fmt.Sprint(v)
+		}
+		for _, host := range g.Hosts {
+			inv.addHost(name, host, nil)
+		}
+		for _, child := range g.Children {
+			inv.addChild(name, child)
+		}
+	}
+
+	for host, vars := range meta.HostVars {
+		if _, ok := inv.Hosts[host]; !ok {
+			inv.addHost("ungrouped", host, nil)
+		}
+		for k, v := range vars {
+			inv.Hosts[host][k] = fmt.Sprint(v)
+		}
+	}
+	sort.Strings(inv.HostOrder)
+
+	return
+}
+
+// inventoryRangeReg is the host range pattern of Ansible inventory. ex.) `web[01:10]`, `db-[a:f]`
+var inventoryRangeReg = regexp.MustCompile(`\[([0-9a-zA-Z]+):([0-9a-zA-Z]+)(?::([0-9]+))?\]`)
+
+// expandInventoryHostRange expand the host range pattern. ex.) `web[01:03]` => web01, web02, web03
+func expandInventoryHostRange(host string) (hosts []string) {
+	loc := inventoryRangeReg.FindStringSubmatchIndex(host)
+	if loc == nil {
+		return []string{host}
+	}
+
+	m := inventoryRangeReg.FindStringSubmatch(host)
+	prefix, suffix := host[:loc[0]], host[loc[1]:]
+	start, end := m[1], m[2]
+
+	step := 1
+	if m[3] != "" {
+		step, _ = strconv.Atoi(m[3])
+		if step < 1 {
+			step = 1
+		}
+	}
+
+	values := []string{}
+	startNum, err1 := strconv.Atoi(start)
+	endNum, err2 := strconv.Atoi(end)
+	switch {
+	case err1 == nil && err2 == nil:
+		format := "%d"
+		if len(start) > 1 && strings.HasPrefix(start, "0") {
+			format = "%0" + strconv.Itoa(len(start)) + "d"
+		}
+		for i := startNum; i <= endNum; i += step {
+			values = append(values, fmt.Sprintf(format, i))
+		}
+
+	case len(start) == 1 && len(end) == 1:
+		for c := start[0]; c <= end[0]; c += byte(step) {
+			values = append(values, string(c))
+			if int(c)+step > 255 {
+				break
+			}
+		}
+
+	default:
+		return []string{host}
+	}
+
+	for _, v := range values {
+		hosts = append(hosts, expandInventoryHostRange(prefix+v+suffix)...)
+	}
+
+	return
+}
+
+// splitInventoryHostPort split `host:port` of INI inventory. IPv6 address is not split.
+func splitInventoryHostPort(host string) (h, port string, ok bool) {
+	if strings.Count(host, ":") != 1 {
+		return
+	}
+
+	i := strings.Index(host, ":")
+	if _, err := strconv.Atoi(host[i+1:]); err != nil {
+		return
+	}
+
+	return host[:i], host[i+1:], true
+}
+
+// unquoteInventoryValue remove the quotes of value.
+func unquoteInventoryValue(value string) string {
+	if len(value) >= 2 {
+		if (value[0] == '"' && value[len(value)-1] == '"') || (value[0] == '\'' && value[len(value)-1] == '\'') {
+			return value[1 : len(value)-1]
+		}
+	}
+
+	return value
+}
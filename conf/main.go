@@ -19,34 +19,42 @@ conf is a package used to read configuration file (~/.lssh.conf).
 package conf
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"fmt"
 	"log"
 	"os"
-	"strings"
-	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/blacknon/lssh/common"
+	"gopkg.in/yaml.v3"
 )
 
 // Config is Struct that stores the entire configuration file.
 type Config struct {
-	Log      LogConfig
-	Shell    ShellConfig
-	Include  map[string]IncludeConfig
-	Includes IncludesConfig
-	Common   ServerConfig
-	Server   map[string]ServerConfig
-	Proxy    map[string]ProxyConfig
-
-	SSHConfig map[string]OpenSSHConfig
+	Log      LogConfig                `yaml:"log"`
+	Shell    ShellConfig              `yaml:"shell"`
+	List     ListConfig               `yaml:"list"`
+	Include  map[string]IncludeConfig `yaml:"include"`
+	Includes IncludesConfig           `yaml:"includes"`
+	Common   ServerConfig             `yaml:"common"`
+	Group    map[string]GroupConfig   `yaml:"group"`
+	Server   map[string]ServerConfig  `yaml:"server"`
+	Proxy    map[string]ProxyConfig   `yaml:"proxy"`
+
+	SSHConfig map[string]OpenSSHConfig   `yaml:"sshconfig"`
+	Inventory map[string]InventoryConfig `yaml:"inventory"`
+	Dynamic   map[string]DynamicConfig   `yaml:"dynamic"`
+
+	// include files, read by readIncludeSettings.
+	includeFiles []includeFile
+	includeRead  bool
+
+	// the file (or the host source) that each server came from.
+	serverSources map[string]string
 }
 
-// ReduceCommon reduce common setting (in .lssh.conf servers)
+// ReduceCommon reduce group and common setting (in .lssh.conf servers)
 func (c *Config) ReduceCommon() {
 	for key, value := range c.Server {
+		value = c.reduceGroup(key, value)
 		setValue := serverConfigReduct(c.Common, value)
 		c.Server[key] = setValue
 	}
@@ -59,75 +67,70 @@ func (c *Config) ReadOpenSSHConfig() {
 		if err == nil {
 			// append data
 			for key, value := range openSSHServerConfig {
-				value := serverConfigReduct(c.Common, value)
+				value = c.reduceGroup(key, value)
+				value = serverConfigReduct(c.Common, value)
 				c.Server[key] = value
+				c.setServerSource(key, "~/.ssh/config")
 			}
 		}
 	} else {
-		for _, sc := range c.SSHConfig {
+		for name, sc := range c.SSHConfig {
 			openSSHServerConfig, err := getOpenSSHConfig(sc.Path, sc.Command)
 			if err == nil {
 				// append data
 				for key, value := range openSSHServerConfig {
 					setCommon := serverConfigReduct(c.Common, sc.ServerConfig)
+					value = c.reduceGroup(key, value)
 					value = serverConfigReduct(setCommon, value)
 					c.Server[key] = value
+					c.setServerSource(key, getSourceText("sshconfig."+name, sc.Path, sc.Command))
 				}
 			}
 		}
 	}
 }
 
-// ReadIncludeFiles read include files and append to Config.Server.
-func (c *Config) ReadIncludeFiles() {
-	if c.Includes.Path != nil {
-		if c.Include == nil {
-			c.Include = map[string]IncludeConfig{}
-		}
-
-		for _, includePath := range c.Includes.Path {
-			// get abs path
-			includePath = common.GetFullPath(includePath)
-
-			unixTime := time.Now().Unix()
-			keyString := strings.Join([]string{fmt.Sprint(unixTime), includePath}, "_")
+// setServerSource set the file (or the host source) that server came from.
+func (c *Config) setServerSource(server, source string) {
+	if c.serverSources == nil {
+		c.serverSources = map[string]string{}
+	}
+	c.serverSources[server] = source
+}
 
-			// key to md5
-			hasher := md5.New()
-			hasher.Write([]byte(keyString))
-			key := string(hex.EncodeToString(hasher.Sum(nil)))
+// GetServerSource return the file (or the host source) that server came from.
+func (c *Config) GetServerSource(server string) string {
+	return c.serverSources[server]
+}
 
-			// append c.Include[key]
-			c.Include[key] = IncludeConfig{includePath}
-		}
+// getSourceText return the text of host source section for GetServerSource.
+// ex.) `inventory.prod (~/ansible/hosts)`, `dynamic.aws (command: ~/bin/aws-hosts.sh)`
+func getSourceText(section, path, command string) string {
+	if command != "" {
+		return section + " (command: " + command + ")"
 	}
 
-	// Read include files
-	if c.Include != nil {
-		for _, v := range c.Include {
-			var includeConf Config
-
-			// user path
-			path := common.GetFullPath(v.Path)
+	return section + " (" + path + ")"
+}
 
-			// Read include config file
-			_, err := toml.DecodeFile(path, &includeConf)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "err: Read config file error: %s", err)
-				os.Exit(1)
-			}
+// decodeFile read the config file (TOML or YAML) into v.
+// If the extension of path is `.yaml` or `.yml`, it is read as YAML. Otherwise, it is read as TOML.
+func decodeFile(path string, v interface{}) (err error) {
+	switch {
+	case isYAMLFile(path):
+		var data []byte
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return
+		}
 
-			// reduce common setting
-			setCommon := serverConfigReduct(c.Common, includeConf.Common)
+		err = yaml.Unmarshal(data, v)
 
-			// add include file serverconf
-			for key, value := range includeConf.Server {
-				// reduce common setting
-				setValue := serverConfigReduct(setCommon, value)
-				c.Server[key] = setValue
-			}
-		}
+	default:
+		_, err = toml.DecodeFile(path, v)
 	}
+
+	return
 }
 
 // checkFormatServerConf checkes format of server config.
@@ -168,11 +171,22 @@ func Read(confPath string) (c Config) {
 	// TODO(blacknon): ~/.lssh.confがなくても、openssh用のファイルがアレばそれをみるように処理
 	if common.IsExist(confPath) {
 		// Read config file
-		_, err := toml.DecodeFile(confPath, &c)
+		err := decodeFile(confPath, &c)
 		if err != nil {
-			log.Println(err)
+			log.Printf("%s: %s\n", confPath, err)
 			os.Exit(1)
 		}
+
+		for key := range c.Server {
+			c.setServerSource(key, confPath)
+		}
+	}
+
+	// read include files, and merge proxy, group and sshconfig settings
+	err := c.readIncludeSettings()
+	if err != nil {
+		log.Println(err)
+		os.Exit(1)
 	}
 
 	// reduce common setting (in .lssh.conf servers)
@@ -181,6 +195,12 @@ func Read(confPath string) (c Config) {
 	// Read OpensSH configs
 	c.ReadOpenSSHConfig()
 
+	// Read Ansible inventories
+	c.ReadInventory()
+
+	// Read dynamic host sources
+	c.ReadDynamic()
+
 	// for append includes to include.path
 	c.ReadIncludeFiles()
 
@@ -199,7 +219,7 @@ func Read(confPath string) (c Config) {
 // Passes having a value. No checking a validity of each fields.
 func checkFormatServerConfAuth(c ServerConfig) (ok bool) {
 	ok = false
-	if c.Pass != "" || c.Key != "" || c.Cert != "" {
+	if c.Pass != "" || c.PassCommand != "" || c.Key != "" || c.Cert != "" {
 		ok = true
 	}
 
@@ -2,45 +2,275 @@
 // Use of this source code is governed by an MIT license
 // that can be found in the LICENSE file.
 
+// This file describes the code to import the OpenSSH config file.
+// The config is evaluated for each host like ssh(1): the first obtained value is used,
+// and IdentityFile, CertificateFile, LocalForward, RemoteForward and DynamicForward
+// can be specified multiple times. Include and Match are also supported.
+
 package conf
 
 import (
+	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"os/user"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/blacknon/lssh/common"
-	"github.com/kevinburke/ssh_config"
 )
 
-// readOpenSSHConfig open the OpenSSH configuration file, return *ssh_config.Config.
-func readOpenSSHConfig(path, command string) (cfg *ssh_config.Config, err error) {
-	var rd io.Reader
+const (
+	// max depth of Include directive.
+	openSSHMaxIncludeDepth = 16
+
+	// max depth of ProxyJump chain.
+	openSSHMaxJumpDepth = 16
+
+	// system config file, read with ~/.ssh/config.
+	openSSHSystemConfig = "/etc/ssh/ssh_config"
+)
+
+// openSSHMultiKeys are keys that can be specified multiple times.
+var openSSHMultiKeys = map[string]bool{
+	"identityfile":    true,
+	"certificatefile": true,
+	"localforward":    true,
+	"remoteforward":   true,
+	"dynamicforward":  true,
+}
+
+// openSSHCondition is the condition of Host or Match block.
+type openSSHCondition struct {
+	// host or match
+	Type string
+	Args []string
+}
+
+// openSSHOption is an option line of OpenSSH config.
+type openSSHOption struct {
+	// Condition is the block of option. If nil, it is applied to all hosts.
+	Condition *openSSHCondition
+
+	// Key is lower case.
+	Key  string
+	Args []string
+}
+
+// openSSHConfig is the parsed OpenSSH config.
+type openSSHConfig struct {
+	Options []openSSHOption
+
+	// explicit host names of Host lines (without wildcard and negation), in order.
+	Hosts []string
+
+	// result of `Match exec`
+	execCache map[string]bool
+}
+
+// readOpenSSHConfig open the OpenSSH configuration file, return *openSSHConfig.
+// If path is ~/.ssh/config, /etc/ssh/ssh_config is also read like ssh(1).
+func readOpenSSHConfig(path, command string) (cfg *openSSHConfig, err error) {
+	cfg = &openSSHConfig{execCache: map[string]bool{}}
+
 	switch {
 	case path != "": // 1st
 		// Read OpenSSH Config
 		sshConfigFile := common.GetFullPath(path)
-		rd, err = os.Open(sshConfigFile)
+		err = cfg.parseFile(sshConfigFile, nil, 0)
+		if err != nil {
+			return
+		}
+
+		if sshConfigFile == common.GetFullPath("~/.ssh/config") && common.IsExist(openSSHSystemConfig) {
+			err = cfg.parseFile(openSSHSystemConfig, nil, 0)
+		}
+
 	case command != "": // 2nd
 		var data []byte
 		cmd := exec.Command("sh", "-c", command)
 		data, err = cmd.Output()
-		rd = bytes.NewReader(data)
+		if err != nil {
+			return
+		}
+
+		err = cfg.parse(bytes.NewReader(data), "", nil, 0)
 	}
 
-	// error check
+	return
+}
+
+// parseFile parse the OpenSSH config file.
+func (c *openSSHConfig) parseFile(path string, cond *openSSHCondition, depth int) (err error) {
+	f, err := os.Open(path)
 	if err != nil {
 		return
 	}
+	defer f.Close()
+
+	return c.parse(f, path, cond, depth)
+}
+
+// parse the OpenSSH config. cond is the condition of the block that includes this file.
+func (c *openSSHConfig) parse(r io.Reader, path string, cond *openSSHCondition, depth int) (err error) {
+	scanner := bufio.NewScanner(r)
+
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+
+		key, args, perr := parseOpenSSHLine(scanner.Text())
+		if perr != nil {
+			return fmt.Errorf("%s:%d: %s", path, lineNum, perr)
+		}
+		if key == "" {
+			continue
+		}
+
+		switch key {
+		case "host":
+			cond = &openSSHCondition{Type: key, Args: splitOpenSSHList(args)}
+			for _, pattern := range cond.Args {
+				if !strings.ContainsAny(pattern, "*?!") && !common.Contains(c.Hosts, pattern) {
+					c.Hosts = append(c.Hosts, pattern)
+				}
+			}
+
+		case "match":
+			cond = &openSSHCondition{Type: key, Args: args}
+
+		case "include":
+			if depth >= openSSHMaxIncludeDepth {
+				return fmt.Errorf("%s:%d: too many nested Include", path, lineNum)
+			}
+
+			for _, arg := range args {
+				files, _ := filepath.Glob(getOpenSSHIncludePath(arg, path))
+				sort.Strings(files)
+
+				for _, file := range files {
+					err = c.parseFile(file, cond, depth+1)
+					if err != nil {
+						return
+					}
+				}
+			}
+
+		default:
+			c.Options = append(c.Options, openSSHOption{Condition: cond, Key: key, Args: args})
+		}
+	}
+
+	return scanner.Err()
+}
+
+// get evaluate the config for host, and return the values of each key.
+// Keys in openSSHMultiKeys have all values, others have the first value.
+func (c *openSSHConfig) get(host string) (values map[string][]string) {
+	values = map[string][]string{}
+
+	for _, o := range c.Options {
+		if !c.match(o.Condition, host, values) {
+			continue
+		}
+
+		if openSSHMultiKeys[o.Key] {
+			values[o.Key] = append(values[o.Key], strings.Join(o.Args, " "))
+			continue
+		}
+
+		if _, ok := values[o.Key]; !ok {
+			values[o.Key] = []string{strings.Join(o.Args, " ")}
+		}
+	}
 
-	cfg, err = ssh_config.Decode(rd)
 	return
 }
 
+// match returns true if the condition matches the host.
+// values is the values obtained so far, used for `Match host` and `Match user`.
+func (c *openSSHConfig) match(cond *openSSHCondition, host string, values map[string][]string) bool {
+	if cond == nil {
+		return true
+	}
+
+	if cond.Type == "host" {
+		return matchOpenSSHPatterns(cond.Args, host)
+	}
+
+	// Match
+	hostname := getOpenSSHValue(values, "hostname", host)
+	hostname = strings.Replace(hostname, "%h", host, -1)
+	remoteUser := getOpenSSHValue(values, "user", getLocalUser())
+
+	args := cond.Args
+	for i := 0; i < len(args); i++ {
+		criteria := strings.ToLower(args[i])
+		negate := strings.HasPrefix(criteria, "!")
+		criteria = strings.TrimPrefix(criteria, "!")
+
+		// criteria without argument
+		var result bool
+		switch criteria {
+		case "all", "canonical", "final":
+			result = true
+
+		case "exec", "host", "originalhost", "user", "localuser", "localnetwork", "tagged":
+			if i+1 >= len(args) {
+				return false
+			}
+			i++
+			arg := args[i]
+
+			switch criteria {
+			case "exec":
+				result = c.matchExec(arg, host, hostname, remoteUser, values)
+			case "host":
+				result = matchOpenSSHPatterns(splitOpenSSHList([]string{arg}), hostname)
+			case "originalhost":
+				result = matchOpenSSHPatterns(splitOpenSSHList([]string{arg}), host)
+			case "user":
+				result = matchOpenSSHPatterns(splitOpenSSHList([]string{arg}), remoteUser)
+			case "localuser":
+				result = matchOpenSSHPatterns(splitOpenSSHList([]string{arg}), getLocalUser())
+			default:
+				// localnetwork and tagged are not supported.
+				result = false
+			}
+
+		default:
+			return false
+		}
+
+		if result == negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchExec run the command of `Match exec`, and returns true if it exits with 0.
+func (c *openSSHConfig) matchExec(command, host, hostname, remoteUser string, values map[string][]string) bool {
+	port := getOpenSSHValue(values, "port", "22")
+	command = expandOpenSSHToken(command, host, hostname, remoteUser, port)
+
+	if result, ok := c.execCache[command]; ok {
+		return result
+	}
+
+	err := exec.Command("sh", "-c", command).Run()
+	c.execCache[command] = err == nil
+
+	return err == nil
+}
+
 // getOpenSSHConfig loads the specified OpenSSH configuration file and returns it in conf.ServerConfig format
 func getOpenSSHConfig(path, command string) (config map[string]ServerConfig, err error) {
 	config = map[string]ServerConfig{}
@@ -57,115 +287,418 @@ func getOpenSSHConfig(path, command string) (config map[string]ServerConfig, err
 		ele = "generate_sshconfig"
 	}
 
-	// Get Node names
-	hostList := []string{}
-	for _, h := range cfg.Hosts {
-		// not supported wildcard host
-		re := regexp.MustCompile("\\*")
-		for _, pattern := range h.Patterns {
-			if !re.MatchString(pattern.String()) {
-				hostList = append(hostList, pattern.String())
-			}
+	b := &openSSHBuilder{cfg: cfg, ele: ele, config: config}
+
+	// append ServerConfig
+	for _, host := range cfg.Hosts {
+		serverConfig, jumps := b.serverConfig(host)
+		if len(jumps) > 0 {
+			serverConfig.Proxy = b.addJumps(jumps, 0)
+			serverConfig.ProxyCommand = ""
 		}
+
+		serverName := ele + ":" + host
+		config[serverName] = serverConfig
 	}
 
-	// append ServerConfig
-	for _, host := range hostList {
-		serverConfig := ServerConfig{
-			Addr:         ssh_config.Get(host, "HostName"),
-			Port:         ssh_config.Get(host, "Port"),
-			User:         ssh_config.Get(host, "User"),
-			ProxyCommand: ssh_config.Get(host, "ProxyCommand"),
-			PreCmd:       ssh_config.Get(host, "LocalCommand"),
-			Note:         "from:" + ele,
+	return config, err
+}
+
+// openSSHBuilder create ServerConfig from openSSHConfig.
+type openSSHBuilder struct {
+	cfg    *openSSHConfig
+	ele    string
+	config map[string]ServerConfig
+}
+
+// serverConfig return ServerConfig of host, and the ProxyJump hosts.
+func (b *openSSHBuilder) serverConfig(host string) (serverConfig ServerConfig, jumps []string) {
+	values := b.cfg.get(host)
+
+	serverConfig = ServerConfig{
+		Addr:         getOpenSSHValue(values, "hostname", host),
+		Port:         getOpenSSHValue(values, "port", "22"),
+		User:         getOpenSSHValue(values, "user", getLocalUser()),
+		ProxyCommand: getOpenSSHValue(values, "proxycommand", ""),
+		PreCmd:       getOpenSSHValue(values, "localcommand", ""),
+		Note:         "from:" + b.ele,
+	}
+	serverConfig.Addr = strings.Replace(serverConfig.Addr, "%h", host, -1)
+	if serverConfig.ProxyCommand == "none" {
+		serverConfig.ProxyCommand = ""
+	}
+
+	expand := func(value string) string {
+		value = expandOpenSSHToken(value, host, serverConfig.Addr, serverConfig.User, serverConfig.Port)
+		return common.GetFullPath(value)
+	}
+
+	// IdentityFile and CertificateFile
+	keys := []string{}
+	for _, key := range values["identityfile"] {
+		if strings.ToLower(key) != "none" {
+			keys = append(keys, expand(key))
 		}
+	}
+
+	certs := []string{}
+	for _, cert := range values["certificatefile"] {
+		if strings.ToLower(cert) != "none" {
+			certs = append(certs, expand(cert))
+		}
+	}
+
+	switch {
+	case len(certs) > 0 && len(keys) > 0:
+		serverConfig.Cert = certs[0]
+		serverConfig.CertKey = keys[0]
+		serverConfig.Keys = keys[1:]
+	case len(keys) == 1:
+		serverConfig.Key = keys[0]
+	case len(keys) > 1:
+		serverConfig.Keys = keys
+	}
+
+	// PKCS11 provider
+	pkcs11Provider := getOpenSSHValue(values, "pkcs11provider", "none")
+	if pkcs11Provider != "none" {
+		serverConfig.PKCS11Use = true
+		serverConfig.PKCS11Provider = pkcs11Provider
+	}
+
+	// agent forwarding
+	if isOpenSSHYes(values, "forwardagent") {
+		serverConfig.SSHAgentUse = true
+	}
+
+	// x11 forwarding
+	if isOpenSSHYes(values, "forwardx11") {
+		serverConfig.X11 = true
+	}
+	if isOpenSSHYes(values, "forwardx11trusted") && serverConfig.X11 {
+		serverConfig.X11Trusted = true
+	}
 
-		if serverConfig.Addr == "" {
-			serverConfig.Addr = host
+	// host key checking
+	serverConfig.StrictHostKeyChecking = getOpenSSHValue(values, "stricthostkeychecking", "")
+	if knownHosts := getOpenSSHValue(values, "userknownhostsfile", ""); knownHosts != "" {
+		for _, f := range strings.Fields(knownHosts) {
+			serverConfig.KnownHostsFiles = append(serverConfig.KnownHostsFiles, expand(f))
 		}
+	}
 
-		if serverConfig.User == "" {
-			serverConfig.User = os.Getenv("USER")
+	// timeout and keepalive
+	serverConfig.ConnectTimeout, _ = strconv.Atoi(getOpenSSHValue(values, "connecttimeout", "0"))
+	serverConfig.ServerAliveCountInterval, _ = strconv.Atoi(getOpenSSHValue(values, "serveraliveinterval", "0"))
+	serverConfig.ServerAliveCountMax, _ = strconv.Atoi(getOpenSSHValue(values, "serveralivecountmax", "0"))
+
+	// Port forwarding (Local forward)
+	for _, fw := range values["localforward"] {
+		if value, ok := convertOpenSSHForward(fw, false); ok {
+			serverConfig.PortForwards = append(serverConfig.PortForwards, "L:"+value)
 		}
+	}
 
-		// TODO(blacknon): OpenSSSH設定ファイルだと、Certificateは複数指定可能な模様。ただ、あまり一般的な使い方ではないようなので、現状は複数のファイルを受け付けるように作っていない。
-		key := ssh_config.Get(host, "IdentityFile")
-		cert := ssh_config.Get(host, "Certificate")
-		if cert != "" {
-			serverConfig.Cert = cert
-			serverConfig.CertKey = key
-		} else {
-			serverConfig.Key = key
+	// Port forwarding (Remote forward). If only port is specified, it is reverse dynamic forward.
+	for _, fw := range values["remoteforward"] {
+		if value, ok := convertOpenSSHForward(fw, true); ok {
+			serverConfig.PortForwards = append(serverConfig.PortForwards, "R:"+value)
+		} else if port := getOpenSSHForwardPort(fw); port != "" && serverConfig.ReverseDynamicPortForward == "" {
+			serverConfig.ReverseDynamicPortForward = port
 		}
+	}
+
+	// Port forwarding (Dynamic forward)
+	if dynamicForward := values["dynamicforward"]; len(dynamicForward) > 0 {
+		serverConfig.DynamicPortForward = getOpenSSHForwardPort(dynamicForward[0])
+	}
+
+	// ProxyJump
+	jump := getOpenSSHValue(values, "proxyjump", "none")
+	if jump != "none" {
+		jumps = strings.Split(jump, ",")
+	}
+
+	return
+}
+
+// addJumps add the ProxyJump hosts to config, and return the server name of the last jump host.
+// The first jump host uses its own proxy setting, and the next jump hosts use the previous jump host as proxy.
+// The next jump hosts are named `<previous jump host>><spec>`, because the Host of the same name may have another proxy.
+func (b *openSSHBuilder) addJumps(jumps []string, depth int) (name string) {
+	if depth >= openSSHMaxJumpDepth {
+		return
+	}
+
+	prev := ""
+	for i, spec := range jumps {
+		jumpUser, host, port := parseOpenSSHJump(spec)
+
+		serverConfig, hostJumps := b.serverConfig(host)
+		serverConfig.Note = "from:" + b.ele + " (ProxyJump)"
 
-		// PKCS11 provider
-		pkcs11Provider := ssh_config.Get(host, "PKCS11Provider")
-		if pkcs11Provider != "" {
-			serverConfig.PKCS11Use = true
-			serverConfig.PKCS11Provider = pkcs11Provider
+		if jumpUser != "" {
+			serverConfig.User = jumpUser
 		}
+		if port != "" {
+			serverConfig.Port = port
+		}
+
+		if i == 0 {
+			name = b.ele + ":" + host
+			if jumpUser != "" || port != "" {
+				name = b.ele + ":" + spec
+			}
 
-		// x11 forwarding
-		x11 := ssh_config.Get(host, "ForwardX11")
-		if x11 == "yes" {
-			serverConfig.X11 = true
+			// the first jump host uses its own ProxyJump
+			if len(hostJumps) > 0 {
+				serverConfig.Proxy = b.addJumps(hostJumps, depth+1)
+				serverConfig.ProxyCommand = ""
+			}
+
+			if _, ok := b.config[name]; !ok {
+				b.config[name] = serverConfig
+			}
+		} else {
+			// the next jump hosts are named by the route, not to be overwritten by the Host of the same name.
+			name = prev + ">" + spec
+			serverConfig.Proxy = prev
+			serverConfig.ProxyCommand = ""
+
+			b.config[name] = serverConfig
 		}
 
-		// Port forwarding (Local forward)
-		localForward := ssh_config.Get(host, "LocalForward")
-		if localForward != "" {
-			array := strings.SplitN(localForward, " ", 2)
-			if len(array) > 1 {
-				var e error
+		prev = name
+	}
 
-				_, e = strconv.Atoi(array[0])
-				if e != nil { // localhost:8080
-					serverConfig.PortForwardLocal = array[0]
-				} else { // 8080
-					serverConfig.PortForwardLocal = "localhost:" + array[0]
-				}
+	return
+}
 
-				_, e = strconv.Atoi(array[1])
-				if e != nil { // localhost:8080
-					serverConfig.PortForwardRemote = array[1]
-				} else { // 8080
-					serverConfig.PortForwardRemote = "localhost:" + array[1]
-				}
+// parseOpenSSHLine parse a line of OpenSSH config, and return the lower case key and arguments.
+// If the line is empty or comment, key is empty.
+func parseOpenSSHLine(line string) (key string, args []string, err error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	// key and value are separated by white space and/or `=`.
+	i := strings.IndexAny(line, " \t=")
+	if i < 0 {
+		return "", nil, fmt.Errorf("no argument: %s", line)
+	}
+	key = strings.ToLower(line[:i])
+	rest := strings.TrimLeft(line[i:], " \t")
+	rest = strings.TrimPrefix(rest, "=")
+
+	args, err = splitOpenSSHArgs(rest)
+	if err == nil && len(args) == 0 {
+		err = fmt.Errorf("no argument: %s", line)
+	}
+
+	return
+}
+
+// splitOpenSSHArgs split arguments with white space. Double quoted string is an argument.
+func splitOpenSSHArgs(s string) (args []string, err error) {
+	var current strings.Builder
+	inQuote, hasArg := false, false
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			hasArg = true
+		case !inQuote && r == '#' && !hasArg:
+			// comment
+			return
+		case !inQuote && (r == ' ' || r == '\t'):
+			if hasArg {
+				args = append(args, current.String())
+				current.Reset()
+				hasArg = false
 			}
+		default:
+			current.WriteRune(r)
+			hasArg = true
 		}
+	}
 
-		// Port forwarding (Remote forward)
-		remoteForward := ssh_config.Get(host, "RemoteForward")
-		if remoteForward != "" {
-			array := strings.SplitN(remoteForward, " ", 2)
-			if len(array) > 1 {
-				var e error
+	if inQuote {
+		return nil, fmt.Errorf("unterminated quote: %s", s)
+	}
+	if hasArg {
+		args = append(args, current.String())
+	}
 
-				_, e = strconv.Atoi(array[0])
-				if e != nil { // localhost:8080
-					serverConfig.PortForwardLocal = array[0]
-				} else { // 8080
-					serverConfig.PortForwardLocal = "localhost:" + array[0]
-				}
+	return
+}
 
-				_, e = strconv.Atoi(array[1])
-				if e != nil { // localhost:8080
-					serverConfig.PortForwardRemote = array[1]
-				} else { // 8080
-					serverConfig.PortForwardRemote = "localhost:" + array[1]
-				}
+// splitOpenSSHList split the comma separated pattern lists.
+func splitOpenSSHList(args []string) (list []string) {
+	for _, arg := range args {
+		for _, v := range strings.Split(arg, ",") {
+			if v != "" {
+				list = append(list, v)
 			}
 		}
+	}
+	return
+}
+
+// matchOpenSSHPatterns returns true if value matches any patterns, and does not match negated patterns.
+func matchOpenSSHPatterns(patterns []string, value string) bool {
+	found := false
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		pattern = strings.TrimPrefix(pattern, "!")
 
-		// Port forwarding (Dynamic forward)
-		dynamicForward := ssh_config.Get(host, "DynamicForward")
-		if dynamicForward != "" {
-			serverConfig.DynamicPortForward = dynamicForward
+		if matchOpenSSHPattern(pattern, value) {
+			if negate {
+				return false
+			}
+			found = true
 		}
+	}
 
-		serverName := ele + ":" + host
-		config[serverName] = serverConfig
+	return found
+}
+
+// matchOpenSSHPattern returns true if value matches the pattern with `*` and `?`.
+func matchOpenSSHPattern(pattern, value string) bool {
+	expr := "^" + regexp.QuoteMeta(pattern) + "$"
+	expr = strings.Replace(expr, `\*`, ".*", -1)
+	expr = strings.Replace(expr, `\?`, ".", -1)
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false
 	}
 
-	return config, err
+	return re.MatchString(value)
+}
+
+// getOpenSSHIncludePath return the path of Include directive.
+// Relative path is from ~/.ssh (user config), or /etc/ssh (system config).
+func getOpenSSHIncludePath(path, parent string) string {
+	if strings.HasPrefix(path, "~") {
+		return common.GetFullPath(path)
+	}
+
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	if parent == openSSHSystemConfig || strings.HasPrefix(parent, "/etc/ssh/") {
+		return filepath.Join("/etc/ssh", path)
+	}
+
+	return filepath.Join(common.GetFullPath("~/.ssh"), path)
+}
+
+// parseOpenSSHJump parse the ProxyJump host `[user@]host[:port]`.
+func parseOpenSSHJump(spec string) (jumpUser, host, port string) {
+	spec = strings.TrimPrefix(spec, "ssh://")
+
+	host = spec
+	if i := strings.LastIndex(host, "@"); i >= 0 {
+		jumpUser = host[:i]
+		host = host[i+1:]
+	}
+
+	// [ipv6]:port
+	if strings.HasPrefix(host, "[") {
+		if i := strings.Index(host, "]"); i > 0 {
+			rest := host[i+1:]
+			host = host[1:i]
+			port = strings.TrimPrefix(rest, ":")
+		}
+		return
+	}
+
+	if i := strings.LastIndex(host, ":"); i >= 0 {
+		port = host[i+1:]
+		host = host[:i]
+	}
+
+	return
+}
+
+// convertOpenSSHForward convert `LocalForward`/`RemoteForward` value ("[bind:]port host:port")
+// to the port_forwards value ("[bind:]port:host:port").
+// In port_forwards, the local address is always first. So if remote is true (`RemoteForward`),
+// the listen address (remote) and the connect address (local) are swapped.
+func convertOpenSSHForward(value string, remote bool) (result string, ok bool) {
+	array := strings.Fields(value)
+	if len(array) != 2 {
+		return
+	}
+
+	result = array[0] + ":" + array[1]
+	if remote {
+		result = array[1] + ":" + array[0]
+	}
+	if _, _, err := common.ParseForwardPort(result); err != nil {
+		return "", false
+	}
+
+	return result, true
+}
+
+// getOpenSSHForwardPort return the port of `[bind:]port`.
+func getOpenSSHForwardPort(value string) string {
+	value = strings.TrimSpace(value)
+	if i := strings.LastIndex(value, ":"); i >= 0 {
+		value = value[i+1:]
+	}
+
+	if _, err := strconv.Atoi(value); err != nil {
+		return ""
+	}
+
+	return value
+}
+
+// expandOpenSSHToken replace the tokens (%h, %n, %p, %r, %u, %d, %%) in value.
+func expandOpenSSHToken(value, host, hostname, remoteUser, port string) string {
+	home := ""
+	if usr, err := user.Current(); err == nil {
+		home = usr.HomeDir
+	}
+
+	return strings.NewReplacer(
+		"%%", "%",
+		"%h", hostname,
+		"%n", host,
+		"%p", port,
+		"%r", remoteUser,
+		"%u", getLocalUser(),
+		"%d", home,
+	).Replace(value)
+}
+
+// getOpenSSHValue return the first value of key, or def if not set.
+func getOpenSSHValue(values map[string][]string, key, def string) string {
+	if v, ok := values[key]; ok && len(v) > 0 {
+		return v[0]
+	}
+	return def
+}
+
+// isOpenSSHYes returns true if the value of key is yes.
+func isOpenSSHYes(values map[string][]string, key string) bool {
+	return strings.ToLower(getOpenSSHValue(values, key, "no")) == "yes"
+}
+
+// getLocalUser return the local user name.
+func getLocalUser() string {
+	if u := os.Getenv("USER"); u != "" {
+		return u
+	}
+
+	if usr, err := user.Current(); err == nil {
+		return usr.Username
+	}
+
+	return ""
 }
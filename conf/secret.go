@@ -0,0 +1,162 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code to resolve the secrets in config.
+//   - `${env:VAR}` in string values is replaced with the environment variable.
+//   - `*_cmd` fields (ex. pass_cmd) are run, and the output is set to the secret field.
+//   - `vault:<name>` in secret fields is replaced with the secret in the vault (see vault.go).
+//
+// These are resolved lazily, when the server is actually used.
+
+package conf
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// envReg is regexp of `${env:VAR}`.
+var envReg = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replace `${env:VAR}` in value with the environment variable.
+// If the environment variable is not set, it is replaced with empty string.
+func ExpandEnv(value string) string {
+	return envReg.ReplaceAllStringFunc(value, func(s string) string {
+		name := envReg.FindStringSubmatch(s)[1]
+		return os.Getenv(name)
+	})
+}
+
+// expandEnvStruct replace `${env:VAR}` in string and []string fields of struct pointer v.
+func expandEnvStruct(v interface{}) {
+	rv := reflect.ValueOf(v).Elem()
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Field(i)
+		if !field.CanSet() {
+			continue
+		}
+
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(ExpandEnv(field.String()))
+		case reflect.Slice:
+			if field.IsNil() || field.Type().Elem().Kind() != reflect.String {
+				continue
+			}
+
+			values := make([]string, field.Len())
+			for j := 0; j < field.Len(); j++ {
+				values[j] = ExpandEnv(field.Index(j).String())
+			}
+			field.Set(reflect.ValueOf(values))
+		}
+	}
+}
+
+// execSecretCommand run command, and return the output without trailing newline.
+func execSecretCommand(command string) (secret string, err error) {
+	stderr := new(bytes.Buffer)
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			err = fmt.Errorf("%s: %s", err, msg)
+		}
+		return
+	}
+
+	secret = strings.TrimRight(string(out), "\r\n")
+	return
+}
+
+// ResolveServerConfig resolve `${env:VAR}`, `*_cmd` fields and `vault:` references in the server config.
+// The output of `*_cmd` takes precedence over the plaintext value.
+// `*_cmd` fields are cleared after running, so that the command is run only once.
+func (c *Config) ResolveServerConfig(server string) (err error) {
+	config, ok := c.Server[server]
+	if !ok {
+		return
+	}
+
+	expandEnvStruct(&config)
+
+	secrets := []struct {
+		name    string
+		command *string
+		value   *string
+	}{
+		{"pass_cmd", &config.PassCommand, &config.Pass},
+		{"keypass_cmd", &config.KeyPassCommand, &config.KeyPass},
+		{"certkeypass_cmd", &config.CertKeyPassCommand, &config.CertKeyPass},
+		{"pkcs11pin_cmd", &config.PKCS11PINCommand, &config.PKCS11PIN},
+	}
+
+	for _, s := range secrets {
+		if *s.command == "" {
+			continue
+		}
+
+		secret, cmdErr := execSecretCommand(*s.command)
+		if cmdErr != nil {
+			err = fmt.Errorf("%s: %s failed: %s", server, s.name, cmdErr)
+			break
+		}
+
+		*s.value = secret
+		*s.command = ""
+	}
+
+	// vault references
+	if err == nil {
+		if vaultErr := resolveVaultServerConfig(&config); vaultErr != nil {
+			err = fmt.Errorf("%s: %s", server, vaultErr)
+		}
+	}
+
+	c.Server[server] = config
+	return
+}
+
+// ResolveProxyConfig resolve `${env:VAR}`, `pass_cmd` and `vault:` reference in the proxy config.
+func (c *Config) ResolveProxyConfig(proxy string) (err error) {
+	config, ok := c.Proxy[proxy]
+	if !ok {
+		return
+	}
+
+	expandEnvStruct(&config)
+
+	if config.PassCommand != "" {
+		secret, cmdErr := execSecretCommand(config.PassCommand)
+		if cmdErr != nil {
+			err = fmt.Errorf("%s: pass_cmd failed: %s", proxy, cmdErr)
+		} else {
+			config.Pass = secret
+			config.PassCommand = ""
+		}
+	}
+
+	// vault reference
+	if err == nil {
+		secret, vaultErr := resolveVaultValue(config.Pass)
+		if vaultErr != nil {
+			err = fmt.Errorf("%s: %s", proxy, vaultErr)
+		} else {
+			config.Pass = secret
+		}
+	}
+
+	c.Proxy[proxy] = config
+	return
+}
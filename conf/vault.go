@@ -0,0 +1,380 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the credential vault.
+// The vault is a local file of secrets, encrypted with the passphrase (scrypt + AES-256-GCM).
+// The secrets are referenced from config as `vault:<name>`.
+//
+// ex.)
+//
+//	[server.db01]
+//	addr = "192.168.100.101"
+//	user = "user"
+//	pass = "vault:prod/db01"
+//
+// The vault is unlocked once per run, when the first `vault:` reference is resolved.
+
+package conf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	// VAULT_PREFIX is the prefix of the vault reference in config.
+	VAULT_PREFIX = "vault:"
+
+	// vault file format version.
+	vaultVersion = 1
+
+	// scrypt parameters. N=2^15, r=8, p=1 is recommended for interactive logins.
+	vaultScryptN = 32768
+	vaultScryptR = 8
+	vaultScryptP = 1
+
+	vaultKeyLength  = 32
+	vaultSaltLength = 16
+)
+
+// vaultAdditionalData is the additional data of AEAD, bound to the vault format.
+var vaultAdditionalData = []byte("lssh-vault-v1")
+
+// VaultPath is the vault file path. If it is empty, DefaultVaultPath() is used.
+var VaultPath = ""
+
+// VaultPassphrase is the passphrase of vault. If it is set, the vault is unlocked with it, without prompt.
+// After the vault is unlocked with prompt, the entered passphrase is set (passed to the background process).
+var VaultPassphrase = ""
+
+// unlockedVault is the vault unlocked in this run.
+var unlockedVault *Vault
+
+// Vault is the encrypted file of secrets.
+type Vault struct {
+	Path string
+
+	file    vaultFile
+	key     []byte
+	secrets map[string]string
+}
+
+// vaultFile is the file format of vault. Secrets are encrypted in Data (JSON of map[string]string).
+type vaultFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// DefaultVaultPath return the default vault file path.
+// If `LSSH_VAULT` is set, it is used. Otherwise, `~/.lssh.vault`.
+func DefaultVaultPath() string {
+	if path := os.Getenv("LSSH_VAULT"); path != "" {
+		return common.GetFullPath(path)
+	}
+
+	return common.GetFullPath("~/.lssh.vault")
+}
+
+// getVaultPath return VaultPath, or the default vault file path.
+func getVaultPath() string {
+	if VaultPath != "" {
+		return common.GetFullPath(VaultPath)
+	}
+
+	return DefaultVaultPath()
+}
+
+// InitVault create the new empty vault file with passphrase.
+// If the file already exists, it returns an error.
+func InitVault(path, passphrase string) (v *Vault, err error) {
+	if common.IsExist(path) {
+		return nil, fmt.Errorf("%s already exists", path)
+	}
+
+	if passphrase == "" {
+		return nil, fmt.Errorf("passphrase is empty")
+	}
+
+	salt := make([]byte, vaultSaltLength)
+	if _, err = rand.Read(salt); err != nil {
+		return
+	}
+
+	v = &Vault{
+		Path: path,
+		file: vaultFile{
+			Version: vaultVersion,
+			KDF:     "scrypt",
+			N:       vaultScryptN,
+			R:       vaultScryptR,
+			P:       vaultScryptP,
+			Salt:    salt,
+		},
+		secrets: map[string]string{},
+	}
+
+	v.key, err = v.file.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	err = v.Save()
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// OpenVault read the vault file, and decrypt it with passphrase.
+func OpenVault(path, passphrase string) (v *Vault, err error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	v = &Vault{Path: path}
+	err = json.Unmarshal(raw, &v.file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	if v.file.Version != vaultVersion || v.file.KDF != "scrypt" {
+		return nil, fmt.Errorf("%s: unsupported vault format (version %d, kdf %s)", path, v.file.Version, v.file.KDF)
+	}
+
+	v.key, err = v.file.deriveKey(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	gcm, err := newVaultCipher(v.key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := gcm.Open(nil, v.file.Nonce, v.file.Data, vaultAdditionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase, or vault is broken", path)
+	}
+
+	v.secrets = map[string]string{}
+	err = json.Unmarshal(data, &v.secrets)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+
+	return
+}
+
+// Get return the secret of name.
+func (v *Vault) Get(name string) (secret string, ok bool) {
+	secret, ok = v.secrets[name]
+	return
+}
+
+// Set set the secret of name. It is written to the file by Save().
+func (v *Vault) Set(name, secret string) {
+	v.secrets[name] = secret
+}
+
+// Remove remove the secret of name. It is written to the file by Save().
+func (v *Vault) Remove(name string) (ok bool) {
+	_, ok = v.secrets[name]
+	delete(v.secrets, name)
+	return
+}
+
+// Names return the names of secrets in sorted order.
+func (v *Vault) Names() (names []string) {
+	for name := range v.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return
+}
+
+// Save encrypt the secrets with the new nonce, and write to the vault file.
+func (v *Vault) Save() (err error) {
+	data, err := json.Marshal(v.secrets)
+	if err != nil {
+		return
+	}
+
+	gcm, err := newVaultCipher(v.key)
+	if err != nil {
+		return
+	}
+
+	v.file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(v.file.Nonce); err != nil {
+		return
+	}
+	v.file.Data = gcm.Seal(nil, v.file.Nonce, data, vaultAdditionalData)
+
+	raw, err := json.MarshalIndent(v.file, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(v.Path), 0700)
+	if err != nil {
+		return
+	}
+
+	// write to temp file and rename, not to break the vault at write error.
+	tmp := v.Path + ".tmp"
+	err = os.WriteFile(tmp, raw, 0600)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tmp, v.Path)
+}
+
+// deriveKey derive the encryption key from passphrase.
+func (f vaultFile) deriveKey(passphrase string) (key []byte, err error) {
+	return scrypt.Key([]byte(passphrase), f.Salt, f.N, f.R, f.P, vaultKeyLength)
+}
+
+// newVaultCipher return AES-256-GCM AEAD with key.
+func newVaultCipher(key []byte) (gcm cipher.AEAD, err error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// UnlockVault open the vault of VaultPath. It is unlocked only once per run.
+// If VaultPassphrase is not set, the passphrase is entered from the terminal.
+func UnlockVault() (v *Vault, err error) {
+	if unlockedVault != nil {
+		return unlockedVault, nil
+	}
+
+	path := getVaultPath()
+	if !common.IsExist(path) {
+		return nil, fmt.Errorf("vault %s is not found. create it with `lssh vault init`", path)
+	}
+
+	passphrase := VaultPassphrase
+	if passphrase == "" {
+		passphrase, err = ReadVaultInput(fmt.Sprintf("vault passphrase (%s):", path))
+		if err != nil {
+			return
+		}
+	}
+
+	v, err = OpenVault(path, passphrase)
+	if err != nil {
+		return
+	}
+
+	unlockedVault = v
+	VaultPassphrase = passphrase
+
+	return
+}
+
+// ReadVaultInput read the passphrase or secret without echo from /dev/tty.
+// The prompt is printed to stderr, not to mix with the output (ex. `lssh vault get`).
+func ReadVaultInput(msg string) (input string, err error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, msg)
+	result, err := terminal.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return
+	}
+
+	if len(result) == 0 {
+		return "", fmt.Errorf("input is empty")
+	}
+
+	return string(result), nil
+}
+
+// IsVaultReference return true, if value is `vault:<name>`.
+func IsVaultReference(value string) bool {
+	return strings.HasPrefix(value, VAULT_PREFIX)
+}
+
+// resolveVaultValue replace the vault reference `vault:<name>` in value with the secret.
+// If value is not the vault reference, it is returned as is.
+func resolveVaultValue(value string) (secret string, err error) {
+	if !IsVaultReference(value) {
+		return value, nil
+	}
+
+	v, err := UnlockVault()
+	if err != nil {
+		return
+	}
+
+	name := strings.TrimPrefix(value, VAULT_PREFIX)
+	secret, ok := v.Get(name)
+	if !ok {
+		return "", fmt.Errorf("%s is not found in vault", name)
+	}
+
+	return
+}
+
+// resolveVaultServerConfig replace the vault references in the secret fields of server config.
+// The passphrase part of keys and ssh_agent_key (`<key>::<passphrase>`) is also replaced.
+func resolveVaultServerConfig(config *ServerConfig) (err error) {
+	values := []*string{&config.Pass, &config.KeyPass, &config.CertKeyPass, &config.PKCS11PIN, &config.KeyCommandPass}
+	for i := range config.Passes {
+		values = append(values, &config.Passes[i])
+	}
+
+	for _, value := range values {
+		*value, err = resolveVaultValue(*value)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, keys := range [][]string{config.Keys, config.SSHAgentKeyPath} {
+		for i, key := range keys {
+			pair := strings.SplitN(key, "::", 2)
+			if len(pair) < 2 || !IsVaultReference(pair[1]) {
+				continue
+			}
+
+			pair[1], err = resolveVaultValue(pair[1])
+			if err != nil {
+				return
+			}
+			keys[i] = pair[0] + "::" + pair[1]
+		}
+	}
+
+	return
+}
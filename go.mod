@@ -13,6 +13,7 @@ require (
 	github.com/acarl005/stripansi v0.0.0-20180116102854-5a71ef0e047d // indirect
 	github.com/armon/go-socks5 v0.0.0-20160902184237-e75332964ef5 // indirect
 	github.com/blacknon/crypto11 v1.2.7 // indirect
+	github.com/blacknon/go-nfs-sshlib v0.0.3
 	github.com/blacknon/go-sshlib v0.1.18
 	github.com/blacknon/go-x11auth v0.1.0 // indirect
 	github.com/blacknon/textcol v0.0.1
@@ -23,7 +24,6 @@ require (
 	github.com/dustin/go-humanize v1.0.0
 	github.com/kardianos/osext v0.0.0-20190222173326-2bc1f35cddc0 // indirect
 	github.com/kballard/go-shellquote v0.0.0-20180428030007-95032a82bc51
-	github.com/kevinburke/ssh_config v0.0.0-20190724205821-6cfae18c12b8
 	github.com/kr/fs v0.1.0 // indirect
 	github.com/lunixbochs/vtclean v1.0.0 // indirect
 	github.com/mattn/go-colorable v0.1.7 // indirect
@@ -36,7 +36,7 @@ require (
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/pkg/sftp v1.13.6
 	github.com/pkg/term v1.2.0-beta.2 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/rivo/uniseg v0.2.0 // indirect
 	github.com/sevlyar/go-daemon v0.1.5
 	github.com/stretchr/testify v1.8.0
@@ -47,11 +47,10 @@ require (
 	golang.org/x/net v0.28.0
 	golang.org/x/sys v0.23.0
 	golang.org/x/term v0.23.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	github.com/blacknon/go-nfs-sshlib v0.0.3 // indirect
 	github.com/cyphar/filepath-securejoin v0.2.4 // indirect
 	github.com/go-git/go-billy/v5 v5.5.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
@@ -0,0 +1,311 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+/*
+history is a package that records the connected servers of lssh, lscp and lsftp.
+
+The history file is `${XDG_STATE_HOME}/lssh/history` (default is `~/.local/state/lssh/history`),
+one JSON record per line.
+
+	{"time":"2024-01-01T12:00:00+09:00","host":"web01","mode":"shell","run":"12345-1704078000000000000"}
+
+mode is the connection mode (`shell`, `cmd`, `pshell`, `scp`, `sftp`).
+The servers are recorded when connected, once per run (reconnect and proxy are not recorded).
+run is the id of the run, that is the same for the servers connected in a run.
+*/
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MaxEntries is the max number of history entries. The older entries are removed at Load.
+const MaxEntries = 10000
+
+// frecency weight of the entry, by the age.
+var frecencyWeights = []struct {
+	age    time.Duration
+	weight int
+}{
+	{time.Hour, 16},
+	{24 * time.Hour, 8},
+	{7 * 24 * time.Hour, 2},
+}
+
+// the weight of the entry older than the last of frecencyWeights.
+const frecencyWeightOld = 1
+
+// mutex of writing the history file. servers are connected in parallel.
+var writeMutex = new(sync.Mutex)
+
+// Entry is a record of history.
+type Entry struct {
+	Time time.Time `json:"time"`
+	Host string    `json:"host"`
+	Mode string    `json:"mode"`
+	Run  string    `json:"run,omitempty"`
+}
+
+// History is the entries of history file, in the order of time.
+type History struct {
+	Path    string
+	Entries []Entry
+
+	// cache of Frecency and LastUsed.
+	frecency map[string]int
+	lastUsed map[string]time.Time
+}
+
+// DefaultPath return the history file path.
+// `${XDG_STATE_HOME}/lssh/history` (default is `~/.local/state/lssh/history`).
+func DefaultPath() string {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		usr, _ := user.Current()
+		dir = filepath.Join(usr.HomeDir, ".local", "state")
+	}
+
+	return filepath.Join(dir, "lssh", "history")
+}
+
+// Load read the default history file. If the file does not exist, it returns empty History.
+func Load() (h *History, err error) {
+	return Read(DefaultPath())
+}
+
+// Read read the history file of path.
+// The broken lines are ignored. If the entries are more than MaxEntries, the file is truncated.
+func Read(path string) (h *History, err error) {
+	h = &History{Path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		e := Entry{}
+		if json.Unmarshal(scanner.Bytes(), &e) != nil || e.Host == "" {
+			continue
+		}
+		h.Entries = append(h.Entries, e)
+	}
+
+	if len(h.Entries) > MaxEntries {
+		h.Entries = h.Entries[len(h.Entries)-MaxEntries:]
+		err = h.write()
+	}
+
+	return
+}
+
+// write rewrite the history file with h.Entries.
+func (h *History) write() (err error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, e := range h.Entries {
+		if err = enc.Encode(e); err != nil {
+			return
+		}
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	// write to temp file and rename, not to break the history at write error.
+	tmp := h.Path + ".tmp"
+	err = os.WriteFile(tmp, buf.Bytes(), 0600)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tmp, h.Path)
+}
+
+// Record append the hosts with mode to the history file, and h.Entries, as a run.
+func (h *History) Record(hosts []string, mode string) (err error) {
+	return h.record(hosts, mode, newRunID())
+}
+
+// record append the hosts with mode and run id to the history file, and h.Entries.
+func (h *History) record(hosts []string, mode, run string) (err error) {
+	entries := []Entry{}
+	now := time.Now()
+	for _, host := range hosts {
+		entries = append(entries, Entry{Time: now, Host: host, Mode: mode, Run: run})
+	}
+
+	err = appendEntries(h.Path, entries)
+	if err != nil {
+		return
+	}
+
+	h.Entries = append(h.Entries, entries...)
+	h.frecency, h.lastUsed = nil, nil
+
+	return
+}
+
+// newRunID return the id of run. `<pid>-<unix nano time>`.
+func newRunID() string {
+	return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+}
+
+// Recorder records the connected hosts of a run to the history file.
+// Each host is recorded once, even if it is connected again (ex. auto reconnect).
+type Recorder struct {
+	history *History
+	mode    string
+	run     string
+
+	m        *sync.Mutex
+	recorded map[string]bool
+}
+
+// NewRecorder return the Recorder of a run with mode, that writes to the default history file.
+func NewRecorder(mode string) *Recorder {
+	return &Recorder{
+		history:  &History{Path: DefaultPath()},
+		mode:     mode,
+		run:      newRunID(),
+		m:        new(sync.Mutex),
+		recorded: map[string]bool{},
+	}
+}
+
+// Record append host to the history file, if it is not recorded yet in this run.
+func (rc *Recorder) Record(host string) (err error) {
+	rc.m.Lock()
+	defer rc.m.Unlock()
+
+	if rc.recorded[host] {
+		return
+	}
+
+	err = rc.history.record([]string{host}, rc.mode, rc.run)
+	if err == nil {
+		rc.recorded[host] = true
+	}
+
+	return
+}
+
+// appendEntries append entries to the history file of path.
+func appendEntries(path string, entries []Entry) (err error) {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			return
+		}
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = f.Write(buf.Bytes())
+	return
+}
+
+// LastRun return the hosts of the last run, in the order of recorded.
+// The entries without run id (old history) are treated as a run of each host.
+func (h *History) LastRun() (hosts []string) {
+	if len(h.Entries) == 0 {
+		return
+	}
+
+	last := h.Entries[len(h.Entries)-1]
+	if last.Run == "" {
+		return []string{last.Host}
+	}
+
+	// other runs may be recorded at the same time, so check all entries.
+	seen := map[string]bool{}
+	for _, e := range h.Entries {
+		if e.Run == last.Run && !seen[e.Host] {
+			seen[e.Host] = true
+			hosts = append(hosts, e.Host)
+		}
+	}
+
+	return
+}
+
+// Recent return the recently used hosts (max n), most recent first.
+func (h *History) Recent(n int) (hosts []string) {
+	seen := map[string]bool{}
+	for i := len(h.Entries) - 1; i >= 0 && len(hosts) < n; i-- {
+		host := h.Entries[i].Host
+		if seen[host] {
+			continue
+		}
+
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+
+	return
+}
+
+// Frecency return the frecency score of host. The more recent and frequent, the higher.
+func (h *History) Frecency(host string) int {
+	if h.frecency == nil {
+		h.frecency = map[string]int{}
+
+		now := time.Now()
+		for _, e := range h.Entries {
+			h.frecency[e.Host] += getFrecencyWeight(now.Sub(e.Time))
+		}
+	}
+
+	return h.frecency[host]
+}
+
+// LastUsed return the last used time of host. If host is not in history, it returns zero time.
+func (h *History) LastUsed(host string) time.Time {
+	if h.lastUsed == nil {
+		h.lastUsed = map[string]time.Time{}
+		for _, e := range h.Entries {
+			if e.Time.After(h.lastUsed[e.Host]) {
+				h.lastUsed[e.Host] = e.Time
+			}
+		}
+	}
+
+	return h.lastUsed[host]
+}
+
+// getFrecencyWeight return the frecency weight of the entry of age.
+func getFrecencyWeight(age time.Duration) int {
+	for _, w := range frecencyWeights {
+		if age < w.age {
+			return w.weight
+		}
+	}
+
+	return frecencyWeightOld
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package history
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lssh", "history")
+
+	h, err := Read(path)
+	assert.NoError(t, err)
+	assert.Empty(t, h.LastRun())
+
+	assert.NoError(t, h.Record([]string{"web1", "web2"}, "cmd"))
+	assert.NoError(t, h.Record([]string{"web1"}, "shell"))
+
+	// broken line is ignored
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	f.WriteString("broken\n")
+	f.Close()
+
+	h, err = Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(h.Entries))
+	assert.Equal(t, "shell", h.Entries[2].Mode)
+
+	assert.Equal(t, []string{"web1"}, h.LastRun())
+	assert.Equal(t, []string{"web1", "web2"}, h.Recent(5))
+	assert.Equal(t, []string{"web1"}, h.Recent(1))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestReadMaxEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := &History{Path: path}
+	hosts := []string{}
+	for i := 0; i < MaxEntries+10; i++ {
+		hosts = append(hosts, fmt.Sprintf("web%d", i))
+	}
+	assert.NoError(t, h.Record(hosts, "cmd"))
+
+	h, err := Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxEntries, len(h.Entries))
+	assert.Equal(t, "web10", h.Entries[0].Host)
+
+	// file is truncated
+	h, err = Read(path)
+	assert.NoError(t, err)
+	assert.Equal(t, MaxEntries, len(h.Entries))
+}
+
+func TestFrecency(t *testing.T) {
+	now := time.Now()
+	h := &History{
+		Entries: []Entry{
+			{Time: now.Add(-30 * 24 * time.Hour), Host: "web1"},
+			{Time: now.Add(-3 * 24 * time.Hour), Host: "web1"},
+			{Time: now.Add(-2 * time.Hour), Host: "web1"},
+			{Time: now.Add(-time.Minute), Host: "web2"},
+		},
+	}
+
+	assert.Equal(t, 1+2+8, h.Frecency("web1"))
+	assert.Equal(t, 16, h.Frecency("web2"))
+	assert.Equal(t, 0, h.Frecency("web3"))
+
+	assert.True(t, h.LastUsed("web1").Equal(now.Add(-2*time.Hour)))
+	assert.True(t, h.LastUsed("web3").IsZero())
+}
+
+func TestRecorder(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	rc := NewRecorder("pshell")
+	for _, host := range []string{"web1", "web2", "web1"} {
+		assert.NoError(t, rc.Record(host))
+	}
+
+	// other run is recorded at the same time
+	other := NewRecorder("cmd")
+	assert.NoError(t, other.Record("db1"))
+	assert.NoError(t, rc.Record("web3"))
+
+	h, err := Load()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(h.Entries))
+	assert.Equal(t, "web1", h.Entries[0].Host)
+	assert.Equal(t, "pshell", h.Entries[1].Mode)
+	assert.Equal(t, h.Entries[0].Run, h.Entries[1].Run)
+	assert.NotEqual(t, h.Entries[0].Run, h.Entries[2].Run)
+
+	// hosts of the last run, recorded once
+	assert.Equal(t, []string{"web1", "web2", "web3"}, h.LastRun())
+}
+
+func TestLastRun(t *testing.T) {
+	now := time.Now()
+
+	type TestData struct {
+		desc    string
+		entries []Entry
+		expect  []string
+	}
+	tds := []TestData{
+		{desc: "Empty", entries: nil, expect: nil},
+		{
+			desc: "Multiple hosts",
+			entries: []Entry{
+				{Time: now, Host: "web1", Run: "1"},
+				{Time: now, Host: "web2", Run: "2"},
+				{Time: now, Host: "web3", Run: "2"},
+			},
+			expect: []string{"web2", "web3"},
+		},
+		{
+			desc: "Without run id",
+			entries: []Entry{
+				{Time: now, Host: "web1"},
+				{Time: now, Host: "web2"},
+			},
+			expect: []string{"web2"},
+		},
+	}
+	for _, v := range tds {
+		h := &History{Entries: v.entries}
+		assert.Equal(t, v.expect, h.LastRun(), v.desc)
+	}
+}
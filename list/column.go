@@ -0,0 +1,195 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the list columns and sort, set by [list] in config.
+
+package list
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	runewidth "github.com/mattn/go-runewidth"
+)
+
+// columnTitles is the header title of each column.
+var columnTitles = map[string]string{
+	"name":      "ServerName",
+	"connect":   "Connect Information",
+	"user":      "User",
+	"addr":      "Address",
+	"port":      "Port",
+	"proxy":     "Proxy",
+	"tags":      "Tags",
+	"note":      "Note",
+	"source":    "Source",
+	"last_used": "Last Used",
+}
+
+// lastUsedFormat is the time format of the last_used column.
+const lastUsedFormat = "2006-01-02 15:04"
+
+// getColumns returns the columns to display. The name column is always the first.
+// Unknown columns are ignored.
+func (l *ListInfo) getColumns() (columns []string) {
+	columns = []string{"name"}
+
+	values := l.DataList.List.Columns
+	if len(values) == 0 {
+		values = conf.DefaultListColumns
+	}
+
+	for _, column := range values {
+		if _, ok := columnTitles[column]; !ok || common.Contains(columns, column) {
+			continue
+		}
+		columns = append(columns, column)
+	}
+
+	return
+}
+
+// getSortKey returns the current sort key. default is the sort of [list], or "name".
+func (l *ListInfo) getSortKey() string {
+	if l.SortKey != "" {
+		return l.SortKey
+	}
+
+	if _, ok := columnTitles[l.DataList.List.Sort]; ok || l.DataList.List.Sort == "frecency" {
+		return l.DataList.List.Sort
+	}
+
+	return "name"
+}
+
+// nextSortKey changes the sort key to the next displayed column.
+// If History is set, "frecency" is also in the cycle.
+func (l *ListInfo) nextSortKey() {
+	keys := l.getColumns()
+	if l.History != nil {
+		keys = append(keys, "frecency")
+	}
+	key := l.getSortKey()
+
+	next := keys[0]
+	for i, k := range keys {
+		if k == key && i+1 < len(keys) {
+			next = keys[i+1]
+		}
+	}
+
+	l.SortKey = next
+}
+
+// getServerColumn returns the column value of server.
+func (l *ListInfo) getServerColumn(name, column string) (value string) {
+	s := l.DataList.Server[name]
+
+	switch column {
+	case "name":
+		value = name
+	case "connect":
+		value = s.User + "@" + s.Addr
+	case "user":
+		value = s.User
+	case "addr":
+		value = s.Addr
+	case "port":
+		value = s.Port
+		if value == "" {
+			value = "22"
+		}
+	case "proxy":
+		value = s.Proxy
+		if s.ProxyCommand != "" && s.ProxyCommand != "none" {
+			value = "command"
+		}
+	case "tags":
+		value = strings.Join(s.Tags, ",")
+	case "note":
+		value = s.Note
+	case "source":
+		value = l.DataList.GetServerSource(name)
+	case "last_used":
+		if l.History != nil {
+			if t := l.History.LastUsed(name); !t.IsZero() {
+				value = t.Local().Format(lastUsedFormat)
+			}
+		}
+	}
+
+	return convNewline(value, "")
+}
+
+// getGroupColumn returns the column value of group (`@group`).
+func (l *ListInfo) getGroupColumn(group, column string) (value string) {
+	switch column {
+	case "name":
+		value = conf.GroupPrefix + group
+	case "connect":
+		value = common.CompressHostList(l.DataList.GetGroupMembers(group))
+	case "note":
+		value = l.DataList.Group[group].Note
+	}
+
+	return convNewline(value, "")
+}
+
+// truncateColumn truncates value to the width of column in [list]. The name column is not truncated.
+func (l *ListInfo) truncateColumn(column, value string) string {
+	width := l.DataList.List.Widths[column]
+	if column == "name" || width <= 0 || runewidth.StringWidth(value) <= width {
+		return value
+	}
+
+	return runewidth.Truncate(value, width, "…")
+}
+
+// getSortedNameList returns l.NameList sorted by the current sort key.
+// The same values are sorted by name. The port is compared as number.
+// "frecency" and "last_used" are sorted by History, in descending order.
+func (l *ListInfo) getSortedNameList() (names []string) {
+	names = append(names, l.NameList...)
+	key := l.getSortKey()
+
+	if l.History != nil && (key == "frecency" || key == "last_used") {
+		sort.SliceStable(names, func(i, j int) bool {
+			if key == "frecency" {
+				a, b := l.History.Frecency(names[i]), l.History.Frecency(names[j])
+				if a != b {
+					return a > b
+				}
+			} else {
+				a, b := l.History.LastUsed(names[i]), l.History.LastUsed(names[j])
+				if !a.Equal(b) {
+					return a.After(b)
+				}
+			}
+
+			return names[i] < names[j]
+		})
+
+		return
+	}
+
+	sort.SliceStable(names, func(i, j int) bool {
+		a, b := l.getServerColumn(names[i], key), l.getServerColumn(names[j], key)
+		if a == b {
+			return names[i] < names[j]
+		}
+
+		if na, err := strconv.Atoi(a); err == nil {
+			if nb, err := strconv.Atoi(b); err == nil {
+				return na < nb
+			}
+		}
+
+		return a < b
+	})
+
+	return
+}
@@ -24,46 +24,30 @@ func drawLine(x, y int, str string, colorNum int, backColorNum int) {
 	}
 }
 
-// Highlight lines and draw text based on filtering results
-func drawFilterLine(x, y int, str string, colorNum int, backColorNum int, keywordColorNum int, searchText string) {
+// Highlight the matched characters of keywords, based on filtering results
+func drawFilterLine(x, y int, str string, colorNum int, backColorNum int, keywordColorNum int, searchText string, fuzzy bool) {
 	// SearchText Bounds Space
 	searchWords := strings.Fields(searchText)
+	if len(searchWords) == 0 {
+		return
+	}
 
-	for i := 0; i < len(searchWords); i += 1 {
-		searchLowLine := strings.ToLower(str)
-		searchKeyword := strings.ToLower(searchWords[i])
-		searchKeywordLen := len(searchKeyword)
-		searchKeywordCount := strings.Count(searchLowLine, searchKeyword)
-
-		charLocation := 0
-		for j := 0; j < searchKeywordCount; j += 1 {
-			searchLineData := ""
-
-			// Countermeasure "slice bounds out of range"
-			if charLocation < len(str) {
-				searchLineData = str[charLocation:]
-			}
-			searchLineDataStr := string(searchLineData)
-			searchKeywordIndex := strings.Index(strings.ToLower(searchLineDataStr), searchKeyword)
-
-			charLocation = charLocation + searchKeywordIndex
-			keyword := ""
-
-			// Countermeasure "slice bounds out of range"
-			if charLocation < len(str) {
-				keyword = str[charLocation : charLocation+searchKeywordLen]
-			}
+	_, positions, ok := matchLine(str, searchWords, fuzzy)
+	if !ok {
+		return
+	}
 
-			// Get Multibyte Charctor Location
-			multibyteStrCheckLine := str[:charLocation]
-			multiByteCharLocation := 0
-			for _, multiByteChar := range multibyteStrCheckLine {
-				multiByteCharLocation += runewidth.RuneWidth(multiByteChar)
-			}
+	matched := map[int]bool{}
+	for _, p := range positions {
+		matched[p] = true
+	}
 
-			drawLine(x+multiByteCharLocation, y, keyword, keywordColorNum, backColorNum)
-			charLocation = charLocation + searchKeywordLen
+	// Get Multibyte Charctor Location
+	for i, char := range []rune(str) {
+		if matched[i] {
+			drawLine(x, y, string(char), keywordColorNum, backColorNum)
 		}
+		x += runewidth.RuneWidth(char)
 	}
 }
 
@@ -77,8 +61,8 @@ func (l *ListInfo) draw() {
 	termbox.Clear(termbox.Attribute(l.Term.Color+1), termbox.Attribute(l.Term.BackgroundColor+1))
 
 	// Get Terminal Size
-	_, height := termbox.Size()
-	height = height - l.Term.Headline
+	width, _ := termbox.Size()
+	height := l.getListHeight()
 
 	// Set View List Range
 	firstLine := (l.CursorLine/height)*height + 1
@@ -97,6 +81,14 @@ func (l *ListInfo) draw() {
 	drawLine(len(l.Prompt), 0, l.Keyword, l.Term.Color, l.Term.BackgroundColor)
 	drawLine(l.Term.LeftMargin, 1, l.ViewText[0], 3, l.Term.BackgroundColor)
 
+	// View match mode (toggle with Ctrl + F) and sort column (change with Ctrl + S)
+	mode := "[exact]"
+	if l.Fuzzy {
+		mode = "[fuzzy]"
+	}
+	mode += " [sort:" + l.getSortKey() + "]"
+	drawLine(width-len(mode), 0, mode, 3, l.Term.BackgroundColor)
+
 	// View List
 	for listKey, listValue := range viewList {
 		paddingData := fmt.Sprintf("%-1000s", listValue)
@@ -118,14 +110,22 @@ func (l *ListInfo) draw() {
 			cursorBackColor = 2
 		}
 
+		// Mark the recent servers (from history) at the top of list
+		if firstLine+listKey <= l.recentLines {
+			drawLine(0, listKey+l.Term.Headline, "*", 3, l.Term.BackgroundColor)
+		}
+
 		// Draw filter line
 		drawLine(l.Term.LeftMargin, listKey+l.Term.Headline, paddingData, cursorColor, cursorBackColor)
 
 		// Keyword Highlight
-		drawFilterLine(l.Term.LeftMargin, listKey+l.Term.Headline, paddingData, cursorColor, cursorBackColor, keywordColor, l.Keyword)
+		drawFilterLine(l.Term.LeftMargin, listKey+l.Term.Headline, paddingData, cursorColor, cursorBackColor, keywordColor, l.Keyword, l.Fuzzy)
 		listKey += 1
 	}
 
+	// View preview pane
+	l.drawPreview()
+
 	// Multi-Byte SetCursor
 	x := 0
 	for _, c := range l.Keyword {
@@ -28,9 +28,6 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 	l.CursorLine = 0
 	headLine := 2
 
-	_, height := termbox.Size()
-	height = height - headLine
-
 	l.Keyword = ""
 	allFlag := false // input Ctrl + A flag
 
@@ -63,6 +60,7 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 
 			// AllowRight Key
 			case termbox.KeyArrowRight:
+				height := l.getListHeight()
 				nextPosition := ((l.CursorLine + height) / height) * height
 				if nextPosition+2 <= len(l.ViewText) {
 					l.CursorLine = nextPosition
@@ -71,6 +69,7 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 
 			// AllowLeft Key
 			case termbox.KeyArrowLeft:
+				height := l.getListHeight()
 				beforePosition := ((l.CursorLine - height) / height) * height
 				if beforePosition >= 0 {
 					l.CursorLine = beforePosition
@@ -100,6 +99,32 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 				}
 				l.draw()
 
+			// Ctrl + f Key(toggle exact/fuzzy match mode)
+			case termbox.KeyCtrlF:
+				l.Fuzzy = !l.Fuzzy
+				l.getFilterText()
+				if l.CursorLine > len(l.ViewText)-headLine {
+					l.CursorLine = len(l.ViewText) - headLine
+				}
+				if l.CursorLine < 0 {
+					l.CursorLine = 0
+				}
+				allFlag = false
+				l.draw()
+
+			// Ctrl + s Key(change sort column)
+			case termbox.KeyCtrlS:
+				l.nextSortKey()
+				l.DataText = []string{}
+				l.getText()
+				l.getFilterText()
+				l.draw()
+
+			// Ctrl + p Key(toggle preview pane)
+			case termbox.KeyCtrlP:
+				l.Preview = !l.Preview
+				l.draw()
+
 			// Ctrl + h Key(Help Window)
 			//case termbox.KeyCtrlH:
 
@@ -149,6 +174,7 @@ func (l *ListInfo) keyEvent() (lineData []string) {
 			if ev.Key == termbox.MouseLeft {
 				// mouse select line is (ev.MouseY - headLine) line.
 				mouseSelectLine := ev.MouseY - headLine
+				height := l.getListHeight()
 
 				pageOffset := (l.CursorLine / height) * height
 				if mouseSelectLine >= 0 && mouseSelectLine < height && pageOffset+mouseSelectLine < len(l.ViewText) {
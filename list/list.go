@@ -11,11 +11,12 @@ package list
 import (
 	"bytes"
 	"fmt"
-	"regexp"
+	"sort"
 	"strings"
 	"text/tabwriter"
 
 	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/history"
 	termbox "github.com/nsf/termbox-go"
 )
 
@@ -40,11 +41,26 @@ type ListInfo struct {
 	DataText   []string    // all data text list
 	ViewText   []string    // filtered text list
 	MultiFlag  bool        // multi select flag
+	Fuzzy      bool        // fuzzy match mode (false is exact match mode)
+	Preview    bool        // show preview pane
+	SortKey    string      // sort column (default is the sort of [list] in config)
 	Keyword    string      // input keyword
 	CursorLine int         // cursor line
 	Term       TermInfo
+
+	// ProxyRouteFunc returns the proxy route text of server, shown in preview pane.
+	ProxyRouteFunc func(server string, config conf.Config) (string, error)
+
+	// History is the connection history. If it is set, the recent servers are shown at the top of list.
+	History *history.History
+
+	// the number of recent server lines at the top of ViewText (after header).
+	recentLines int
 }
 
+// RecentMax is the max number of recent servers shown at the top of list.
+const RecentMax = 5
+
 type TermInfo struct {
 	Headline        int
 	LeftMargin      int
@@ -96,15 +112,19 @@ func (l *ListInfo) allToggle(allFlag bool) {
 		SelectedList = append(SelectedList, selectedLine)
 	}
 
+	// recent servers are shown twice, so the names are toggled only once.
+	toggled := map[string]bool{}
+
 	// allFlag is False
 	if allFlag == false {
 		// On each lines that except a header line and are not selected line,
 		// toggles left end fields
 		for _, addLine := range l.ViewText[1:] {
 			addName := strings.Fields(addLine)[0]
-			if !arrayContains(SelectedList, addName) {
+			if !arrayContains(SelectedList, addName) && !toggled[addName] {
 				allSelectedList = append(allSelectedList, addName)
 				l.toggle(addName)
+				toggled[addName] = true
 			}
 		}
 		return
@@ -112,26 +132,50 @@ func (l *ListInfo) allToggle(allFlag bool) {
 		// On each lines that except a header line, toggles left end fields
 		for _, addLine := range l.ViewText[1:] {
 			addName := strings.Fields(addLine)[0]
-			l.toggle(addName)
+			if !toggled[addName] {
+				l.toggle(addName)
+				toggled[addName] = true
+			}
 		}
 		return
 	}
 }
 
 // getText is create view text (use text/tabwriter)
+// The columns and sort are set by [list] in config.
 func (l *ListInfo) getText() {
+	columns := l.getColumns()
+
 	buffer := &bytes.Buffer{}
 	tabWriterBuffer := new(tabwriter.Writer)
 	tabWriterBuffer.Init(buffer, 0, 4, 8, ' ', 0)
-	fmt.Fprintln(tabWriterBuffer, "ServerName \tConnect Information \tNote \t")
+
+	header := ""
+	for _, column := range columns {
+		header += columnTitles[column] + " \t"
+	}
+	fmt.Fprintln(tabWriterBuffer, header)
 
 	// Create list table
-	for _, key := range l.NameList {
-		name := convNewline(key, "")
-		conInfo := convNewline(l.DataList.Server[key].User+"@"+l.DataList.Server[key].Addr, "")
-		note := convNewline(l.DataList.Server[key].Note, "")
+	for _, key := range l.getSortedNameList() {
+		values := []string{}
+		for _, column := range columns {
+			values = append(values, l.truncateColumn(column, l.getServerColumn(key, column)))
+		}
 
-		fmt.Fprintln(tabWriterBuffer, name+"\t"+conInfo+"\t"+note)
+		fmt.Fprintln(tabWriterBuffer, strings.Join(values, "\t"))
+	}
+
+	// Create group table. group is selectable only in multi select.
+	if l.MultiFlag {
+		for _, group := range l.DataList.GetGroupNameList() {
+			values := []string{}
+			for _, column := range columns {
+				values = append(values, l.truncateColumn(column, l.getGroupColumn(group, column)))
+			}
+
+			fmt.Fprintln(tabWriterBuffer, strings.Join(values, "\t"))
+		}
 	}
 
 	tabWriterBuffer.Flush()
@@ -147,38 +191,103 @@ func (l *ListInfo) getText() {
 
 // getFilterText updates l.ViewText with matching keyword (ignore case).
 // DataText sets ViewText if keyword is empty.
+// In fuzzy mode, the lines are matched as subsequence, and sorted by the match score.
 func (l *ListInfo) getFilterText() {
 	// Initialization ViewText
 	l.ViewText = []string{}
 
 	// SearchText Bounds Space
 	keywords := strings.Fields(l.Keyword)
-	r := l.DataText[1:]
-	line := ""
-	tmpText := []string{}
 	l.ViewText = append(l.ViewText, l.DataText[0])
+	l.recentLines = 0
 
 	// if No words
 	if len(keywords) == 0 {
-		l.ViewText = l.DataText
+		recent := l.getRecentText()
+		if len(recent) == 0 {
+			l.ViewText = l.DataText
+			return
+		}
+
+		l.recentLines = len(recent)
+		l.ViewText = append(l.ViewText, recent...)
+		l.ViewText = append(l.ViewText, l.DataText[1:]...)
+		return
+	}
+
+	type matchedLine struct {
+		line  string
+		score int
+	}
+
+	matched := []matchedLine{}
+	for _, line := range l.DataText[1:] {
+		score, _, ok := matchLine(line, keywords, l.Fuzzy)
+		if ok {
+			matched = append(matched, matchedLine{line: line, score: score})
+		}
+	}
+
+	// rank by match quality. same score keeps the list order.
+	if l.Fuzzy {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].score > matched[j].score
+		})
+	}
+
+	for _, m := range matched {
+		l.ViewText = append(l.ViewText, m.line)
+	}
+	return
+}
+
+// Filter returns the server names of the lines matched with keyword, without TUI.
+// The keyword is matched in the same way as the list view (exact or fuzzy by l.Fuzzy).
+// The group lines are not included.
+func (l *ListInfo) Filter(keyword string) (names []string) {
+	l.DataText = []string{}
+	l.getText()
+
+	l.Keyword = keyword
+	l.getFilterText()
+
+	for _, line := range l.ViewText[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !arrayContains(l.NameList, fields[0]) || arrayContains(names, fields[0]) {
+			continue
+		}
+		names = append(names, fields[0])
+	}
+
+	return
+}
+
+// getRecentText returns the lines of recent servers in history (max RecentMax), most recent first.
+func (l *ListInfo) getRecentText() (lines []string) {
+	if l.History == nil {
 		return
 	}
 
-	for i := 0; i < len(keywords); i++ {
-		lowKeyword := regexp.QuoteMeta(strings.ToLower(keywords[i]))
-		re := regexp.MustCompile(lowKeyword)
-		tmpText = []string{}
+	// recent servers that exist in list
+	recent := []string{}
+	for _, name := range l.History.Recent(len(l.History.Entries)) {
+		if arrayContains(l.NameList, name) {
+			recent = append(recent, name)
+		}
+		if len(recent) >= RecentMax {
+			break
+		}
+	}
 
-		for j := 0; j < len(r); j++ {
-			line += string(r[j])
-			if re.MatchString(strings.ToLower(line)) {
-				tmpText = append(tmpText, line)
+	for _, name := range recent {
+		for _, line := range l.DataText[1:] {
+			if fields := strings.Fields(line); len(fields) > 0 && fields[0] == name {
+				lines = append(lines, line)
+				break
 			}
-			line = ""
 		}
-		r = tmpText
 	}
-	l.ViewText = append(l.ViewText, tmpText...)
+
 	return
 }
 
@@ -198,6 +307,18 @@ func (l *ListInfo) View() {
 	termbox.SetInputMode(termbox.InputMouse)
 
 	l.keyEvent()
+
+	// selected group to member servers
+	l.expandSelectGroup()
+}
+
+// expandSelectGroup replace the selected group (`@group`) with the member servers.
+func (l *ListInfo) expandSelectGroup() {
+	selected, err := l.DataList.ExpandHosts(l.SelectName)
+	if err != nil {
+		return
+	}
+	l.SelectName = selected
 }
 
 // convNewline is newline replace to nlcode
@@ -6,8 +6,10 @@ package list
 
 import (
 	"testing"
+	"time"
 
 	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/history"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -257,6 +259,38 @@ func TestGetFilterText(t *testing.T) {
 				"dev_web2           user1@192.168.101.2        WebServer",
 			},
 		},
+		{
+			desc: "Fuzzy (ranked by score)",
+			l: ListInfo{
+				Keyword: "wb1prd",
+				Fuzzy:   true,
+				DataText: []string{
+					"ServerName         Connect Information        Note",
+					"dev_web1           user1@192.168.101.1        WebServer",
+					"web10.stg.prd      user1@192.168.100.10       WebServer",
+					"web1.prd           user1@192.168.100.1        WebServer",
+					"dev_app1           user1@192.168.101.33       ApplicationServer",
+				},
+			},
+			expect: []string{
+				"ServerName         Connect Information        Note",
+				"web1.prd           user1@192.168.100.1        WebServer",
+				"web10.stg.prd      user1@192.168.100.10       WebServer",
+			},
+		},
+		{
+			desc: "Exact (not fuzzy)",
+			l: ListInfo{
+				Keyword: "wb1prd",
+				DataText: []string{
+					"ServerName         Connect Information        Note",
+					"web1.prd           user1@192.168.100.1        WebServer",
+				},
+			},
+			expect: []string{
+				"ServerName         Connect Information        Note",
+			},
+		},
 		// { // Can't use regexp
 		// 	desc: "Regexp \\d",
 		// 	l: ListInfo{
@@ -281,3 +315,194 @@ func TestGetFilterText(t *testing.T) {
 		assert.Equal(t, v.expect, v.l.ViewText, v.desc)
 	}
 }
+
+func TestMatchLine(t *testing.T) {
+	type TestData struct {
+		desc     string
+		line     string
+		keywords []string
+		fuzzy    bool
+		expect   []int
+		expectOk bool
+	}
+	tds := []TestData{
+		{desc: "Exact", line: "Web01 web02", keywords: []string{"web"}, expect: []int{0, 1, 2, 6, 7, 8}, expectOk: true},
+		{desc: "Exact (multi keywords)", line: "prd_web01", keywords: []string{"prd", "01"}, expect: []int{0, 1, 2, 7, 8}, expectOk: true},
+		{desc: "Exact (not match)", line: "prd_web01", keywords: []string{"prd", "02"}, expectOk: false},
+		{desc: "Fuzzy", line: "prd_web01", keywords: []string{"pw1"}, fuzzy: true, expect: []int{0, 4, 8}, expectOk: true},
+		{desc: "Fuzzy (shortest window)", line: "a__ab", keywords: []string{"ab"}, fuzzy: true, expect: []int{3, 4}, expectOk: true},
+		{desc: "Fuzzy (multibyte)", line: "サーバー01", keywords: []string{"サ01"}, fuzzy: true, expect: []int{0, 4, 5}, expectOk: true},
+		{desc: "Fuzzy (not match)", line: "prd_web01", keywords: []string{"wp"}, fuzzy: true, expectOk: false},
+	}
+	for _, v := range tds {
+		_, got, ok := matchLine(v.line, v.keywords, v.fuzzy)
+		assert.Equal(t, v.expectOk, ok, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestGetPreviewText(t *testing.T) {
+	l := ListInfo{
+		DataList: conf.Config{
+			Server: map[string]conf.ServerConfig{
+				"web1": {
+					User: "user1", Addr: "192.168.101.1", Pass: "plain", Keys: []string{"~/.ssh/id_rsa::vault:ssh/key"},
+					PortForwards: []string{"L:8080:localhost:80"}, DynamicPortForward: "11080", Note: "WebServer",
+				},
+			},
+			Group: map[string]conf.GroupConfig{
+				"web": {Servers: []string{"web1"}},
+			},
+		},
+		ProxyRouteFunc: func(server string, config conf.Config) (string, error) {
+			return "localhost => [ssh://bastion] => " + server, nil
+		},
+	}
+
+	expect := []string{
+		"web1",
+		"Connect   user1@192.168.101.1:22",
+		"Proxy     localhost => [ssh://bastion] => web1",
+		"Auth      password ********",
+		"          publickey ~/.ssh/id_rsa (passphrase vault:ssh/key)",
+		"Forward   L localhost:8080 => localhost:80",
+		"          D 11080",
+		"Note      WebServer",
+	}
+	assert.Equal(t, expect, l.getPreviewText("web1"))
+
+	assert.Equal(t, []string{"@web", "Members   web1"}, l.getPreviewText("@web"))
+	assert.Nil(t, l.getPreviewText("unknown"))
+}
+
+func TestGetTextColumns(t *testing.T) {
+	l := ListInfo{
+		NameList: []string{"dev_web1", "dev_web2", "prd_web1"},
+		DataList: conf.Config{
+			List: conf.ListConfig{
+				Columns: []string{"port", "note", "unknown"},
+				Widths:  map[string]int{"note": 6},
+				Sort:    "port",
+			},
+			Server: map[string]conf.ServerConfig{
+				"dev_web1": {User: "user1", Addr: "192.168.101.1", Port: "10022", Note: "WebServer"},
+				"dev_web2": {User: "user1", Addr: "192.168.101.2", Port: "2222", Note: "Web"},
+				"prd_web1": {User: "user1", Addr: "192.168.100.1", Note: "WebServer"},
+			},
+		},
+	}
+
+	l.getText()
+	expect := []string{
+		"ServerName         Port         Note         ",
+		"prd_web1           22           WebSe…",
+		"dev_web2           2222         Web",
+		"dev_web1           10022        WebSe…",
+	}
+	assert.Equal(t, expect, l.DataText)
+
+	// change sort column
+	l.nextSortKey()
+	assert.Equal(t, "note", l.SortKey)
+	l.nextSortKey()
+	assert.Equal(t, "name", l.SortKey)
+}
+
+func TestHistory(t *testing.T) {
+	now := time.Now()
+	h := &history.History{
+		Entries: []history.Entry{
+			{Time: now.Add(-30 * 24 * time.Hour), Host: "dev_web1", Mode: "shell"},
+			{Time: now.Add(-30 * 24 * time.Hour), Host: "dev_web1", Mode: "shell"},
+			{Time: now.Add(-2 * time.Hour), Host: "prd_web1", Mode: "shell"},
+			{Time: now.Add(-time.Minute), Host: "removed", Mode: "shell"},
+			{Time: now, Host: "dev_web2", Mode: "cmd"},
+		},
+	}
+
+	l := ListInfo{
+		NameList: []string{"dev_web1", "dev_web2", "prd_web1", "prd_web2"},
+		DataList: conf.Config{
+			List: conf.ListConfig{Sort: "frecency"},
+			Server: map[string]conf.ServerConfig{
+				"dev_web1": {User: "user1", Addr: "192.168.101.1"},
+				"dev_web2": {User: "user1", Addr: "192.168.101.2"},
+				"prd_web1": {User: "user1", Addr: "192.168.100.1"},
+				"prd_web2": {User: "user1", Addr: "192.168.100.2"},
+			},
+		},
+		History: h,
+	}
+
+	// frecency sort: dev_web2(16), prd_web1(8), dev_web1(1+1), prd_web2(0)
+	assert.Equal(t, []string{"dev_web2", "prd_web1", "dev_web1", "prd_web2"}, l.getSortedNameList())
+
+	// last_used sort
+	l.SortKey = "last_used"
+	assert.Equal(t, []string{"dev_web2", "prd_web1", "dev_web1", "prd_web2"}, l.getSortedNameList())
+
+	// recent section (the server not in list is skipped)
+	l.SortKey = "name"
+	l.getText()
+	l.getFilterText()
+	expect := []string{
+		l.DataText[0],
+		l.DataText[2], // dev_web2
+		l.DataText[3], // prd_web1
+		l.DataText[1], // dev_web1
+	}
+	expect = append(expect, l.DataText[1:]...)
+	assert.Equal(t, expect, l.ViewText)
+	assert.Equal(t, 3, l.recentLines)
+
+	// no recent section with keyword
+	l.Keyword = "prd"
+	l.getFilterText()
+	assert.Equal(t, []string{l.DataText[0], l.DataText[3], l.DataText[4]}, l.ViewText)
+	assert.Equal(t, 0, l.recentLines)
+}
+
+func TestSelectHosts(t *testing.T) {
+	data := conf.Config{
+		Server: map[string]conf.ServerConfig{
+			"dev_web1": {User: "user1", Addr: "192.168.101.1", Note: "web dev"},
+			"prd_web1": {User: "user1", Addr: "192.168.100.1", Note: "web prod"},
+			"prd_web2": {User: "user1", Addr: "192.168.100.2", Note: "web prod"},
+			"prd_db1":  {User: "user1", Addr: "192.168.100.3", Note: "db prod"},
+		},
+	}
+	names := []string{"dev_web1", "prd_db1", "prd_web1", "prd_web2"}
+
+	type TestData struct {
+		desc           string
+		hosts          []string
+		expression     string
+		excludes       []string
+		expect         []string
+		expectRemains  []string
+		expectFiltered bool
+		expectErr      bool
+	}
+	tds := []TestData{
+		{desc: "Names", hosts: []string{"prd_web1"}, expect: []string{"prd_web1"}, expectRemains: names},
+		{desc: "No hosts", expect: nil, expectRemains: names},
+		{desc: "Expression", expression: "web prod", expect: []string{"prd_web1", "prd_web2"}, expectRemains: names, expectFiltered: true},
+		{desc: "Expression with name", expression: "prd_db", expect: []string{"prd_db1"}, expectRemains: names, expectFiltered: true},
+		{desc: "Glob and excludes", hosts: []string{"prd_*"}, excludes: []string{"prd_web2"}, expect: []string{"prd_db1", "prd_web1"}, expectRemains: []string{"dev_web1", "prd_db1", "prd_web1"}, expectFiltered: true},
+		{desc: "Excludes only", excludes: []string{"/^prd_/"}, expect: nil, expectRemains: []string{"dev_web1"}, expectFiltered: true},
+		{desc: "Expression fuzzy (order by score)", expression: "db", expect: []string{"prd_db1", "dev_web1", "prd_web1", "prd_web2"}, expectRemains: names, expectFiltered: true},
+		{desc: "Expression not match", expression: "app", expectErr: true},
+		{desc: "All excluded", hosts: []string{"prd_web1"}, excludes: []string{"prd_*"}, expectErr: true},
+	}
+	for _, v := range tds {
+		got, remains, filtered, err := SelectHosts(data, names, v.hosts, v.expression, v.excludes)
+		if v.expectErr {
+			assert.Error(t, err, v.desc)
+			continue
+		}
+		assert.NoError(t, err, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+		assert.Equal(t, v.expectRemains, remains, v.desc)
+		assert.Equal(t, v.expectFiltered, filtered, v.desc)
+	}
+}
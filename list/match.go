@@ -0,0 +1,205 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of matching the keywords to the list line.
+//   - exact mode: each keyword is a case-insensitive substring.
+//   - fuzzy mode: each keyword is a case-insensitive subsequence (like fzf), and the lines are ranked by score.
+
+package list
+
+import (
+	"unicode"
+)
+
+// fuzzy match score. based on fzf (v1 algorithm).
+const (
+	scoreMatch        = 16
+	scoreGapStart     = -3
+	scoreGapExtension = -1
+
+	// bonus of the character at the word boundary (ex. `web` of `prd_web01`).
+	bonusBoundary = 8
+
+	// bonus of the camel case and letter to number (ex. `W` of `prdWeb`, `0` of `web01`).
+	bonusCamel = 7
+
+	// bonus of the consecutive characters.
+	bonusConsecutive = 4
+
+	// the bonus of first character of keyword is multiplied.
+	bonusFirstCharMultiplier = 2
+)
+
+// matchLine matches all keywords to line, and returns the score and the matched rune positions.
+// If any keyword does not match, ok is false.
+func matchLine(line string, keywords []string, fuzzy bool) (score int, positions []int, ok bool) {
+	text := []rune(line)
+	lowText := toLowerRunes(text)
+
+	for _, keyword := range keywords {
+		pattern := toLowerRunes([]rune(keyword))
+
+		var s int
+		var pos []int
+		if fuzzy {
+			s, pos, ok = fuzzyMatch(text, lowText, pattern)
+		} else {
+			pos, ok = exactMatch(lowText, pattern)
+		}
+
+		if !ok {
+			return 0, nil, false
+		}
+
+		score += s
+		positions = append(positions, pos...)
+	}
+
+	return score, positions, true
+}
+
+// exactMatch returns the positions of all occurrences of pattern in text.
+func exactMatch(text, pattern []rune) (positions []int, ok bool) {
+	if len(pattern) == 0 {
+		return nil, true
+	}
+
+	for i := 0; i+len(pattern) <= len(text); i++ {
+		if !equalRunes(text[i:i+len(pattern)], pattern) {
+			continue
+		}
+
+		for j := range pattern {
+			positions = append(positions, i+j)
+		}
+		i += len(pattern) - 1
+		ok = true
+	}
+
+	return
+}
+
+// fuzzyMatch matches pattern to lowText as subsequence, and returns the score and positions.
+// text is the original (not lower case) runes, used to calculate the bonus.
+//
+// First, the first match window is found by forward scan. Then the window is shortened by
+// backward scan, so that `ab` in `a__ab` matches the last `ab`.
+func fuzzyMatch(text, lowText, pattern []rune) (score int, positions []int, ok bool) {
+	if len(pattern) == 0 {
+		return 0, nil, true
+	}
+
+	// forward scan
+	pidx, start, end := 0, -1, -1
+	for i, r := range lowText {
+		if r != pattern[pidx] {
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+
+		pidx++
+		if pidx == len(pattern) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	// backward scan
+	pidx = len(pattern) - 1
+	for i := end; i >= start; i-- {
+		if lowText[i] != pattern[pidx] {
+			continue
+		}
+
+		pidx--
+		if pidx < 0 {
+			start = i
+			break
+		}
+	}
+
+	// positions and score in window
+	pidx = 0
+	prevBonus := 0
+	for i := start; i <= end && pidx < len(pattern); i++ {
+		if lowText[i] != pattern[pidx] {
+			continue
+		}
+
+		bonus := getCharBonus(text, i)
+		if len(positions) > 0 {
+			prev := positions[len(positions)-1]
+			if prev == i-1 {
+				// consecutive chunk keeps the bonus of its first character
+				if prevBonus > bonus {
+					bonus = prevBonus
+				}
+				if bonus < bonusConsecutive {
+					bonus = bonusConsecutive
+				}
+			} else {
+				score += scoreGapStart + scoreGapExtension*(i-prev-2)
+			}
+		} else {
+			bonus *= bonusFirstCharMultiplier
+		}
+
+		score += scoreMatch + bonus
+		prevBonus = bonus
+		positions = append(positions, i)
+		pidx++
+	}
+
+	return score, positions, true
+}
+
+// getCharBonus returns the bonus of the character at i of text.
+func getCharBonus(text []rune, i int) int {
+	if i == 0 {
+		return bonusBoundary
+	}
+
+	prev, cur := text[i-1], text[i]
+	switch {
+	case !unicode.IsLetter(prev) && !unicode.IsDigit(prev) && (unicode.IsLetter(cur) || unicode.IsDigit(cur)):
+		return bonusBoundary
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return bonusCamel
+	case unicode.IsLetter(prev) && unicode.IsDigit(cur):
+		return bonusCamel
+	}
+
+	return 0
+}
+
+// toLowerRunes returns the lower case runes. The length is not changed.
+func toLowerRunes(runes []rune) []rune {
+	result := make([]rune, len(runes))
+	for i, r := range runes {
+		result[i] = unicode.ToLower(r)
+	}
+
+	return result
+}
+
+// equalRunes returns that a and b are the same runes.
+func equalRunes(a, b []rune) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,270 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the preview pane, that shows the resolved details of the cursor line host.
+// The preview pane is toggled with Ctrl + P. It is shown on the right side if the terminal is wide enough,
+// otherwise at the bottom.
+
+package list
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	runewidth "github.com/mattn/go-runewidth"
+	termbox "github.com/nsf/termbox-go"
+)
+
+// previewSideMinWidth is the terminal width to show the preview pane on the right side.
+const previewSideMinWidth = 120
+
+// previewMask is displayed instead of the plaintext secret.
+const previewMask = "********"
+
+// getListHeight returns the number of list lines, excluding the header and the bottom preview pane.
+func (l *ListInfo) getListHeight() int {
+	width, height := termbox.Size()
+	height = height - l.Term.Headline
+
+	if l.Preview && width < previewSideMinWidth {
+		height = height - height/2
+	}
+
+	if height < 1 {
+		height = 1
+	}
+
+	return height
+}
+
+// drawPreview draw the preview pane of the cursor line host.
+func (l *ListInfo) drawPreview() {
+	if !l.Preview || l.CursorLine+1 >= len(l.ViewText) {
+		return
+	}
+
+	fields := strings.Fields(l.ViewText[l.CursorLine+1])
+	if len(fields) == 0 {
+		return
+	}
+	lines := l.getPreviewText(fields[0])
+
+	width, height := termbox.Size()
+	color := l.Term.Color
+	backColor := l.Term.BackgroundColor
+
+	var x, y, paneWidth, paneHeight int
+	if width >= previewSideMinWidth {
+		// right side
+		x = width * 55 / 100
+		y = 1
+		paneWidth = width - x - 2
+		paneHeight = height - y
+
+		for i := y; i < height; i++ {
+			drawLine(x, i, fmt.Sprintf("│ %-1000s", ""), color, backColor)
+		}
+		x += 2
+	} else {
+		// bottom
+		x = l.Term.LeftMargin
+		y = l.Term.Headline + l.getListHeight()
+		paneWidth = width - x
+		paneHeight = height - y - 1
+
+		drawLine(0, y, strings.Repeat("─", width), color, backColor)
+		for i := y + 1; i < height; i++ {
+			drawLine(0, i, fmt.Sprintf("%-1000s", ""), color, backColor)
+		}
+		y++
+	}
+
+	for i, line := range lines {
+		if i >= paneHeight {
+			break
+		}
+
+		lineColor := color
+		if i == 0 {
+			lineColor = 3
+		}
+		drawLine(x, y+i, runewidth.Truncate(line, paneWidth, ""), lineColor, backColor)
+	}
+}
+
+// getPreviewText returns the preview lines of name (server or @group).
+// The secrets are masked, except the references (`vault:`, `${env:}`).
+func (l *ListInfo) getPreviewText(name string) (lines []string) {
+	add := func(label string, values ...string) {
+		for i, v := range values {
+			if v == "" {
+				continue
+			}
+			if i > 0 {
+				label = ""
+			}
+			lines = append(lines, fmt.Sprintf("%-9s %s", label, v))
+		}
+	}
+
+	// group
+	if strings.HasPrefix(name, conf.GroupPrefix) {
+		group := strings.TrimPrefix(name, conf.GroupPrefix)
+		members := l.DataList.GetGroupMembers(group)
+
+		lines = append(lines, name)
+		add("Members", common.CompressHostList(members))
+		add("Note", l.DataList.Group[group].Note)
+		return
+	}
+
+	s, ok := l.DataList.Server[name]
+	if !ok {
+		return
+	}
+
+	port := s.Port
+	if port == "" {
+		port = "22"
+	}
+
+	lines = append(lines, name)
+	add("Source", l.DataList.GetServerSource(name))
+	add("Connect", s.User+"@"+s.Addr+":"+port)
+
+	// proxy route
+	if l.ProxyRouteFunc != nil {
+		route, err := l.ProxyRouteFunc(name, l.DataList)
+		if err != nil {
+			route = "error: " + err.Error()
+		}
+		add("Proxy", route)
+	}
+
+	add("Auth", getPreviewAuth(s)...)
+	add("Forward", getPreviewForwards(s)...)
+	add("Note", s.Note)
+	add("Tags", strings.Join(s.Tags, ", "))
+
+	return
+}
+
+// getPreviewAuth returns the authentication methods of server config.
+func getPreviewAuth(s conf.ServerConfig) (auth []string) {
+	if s.Pass != "" {
+		auth = append(auth, "password "+maskSecret(s.Pass))
+	}
+	for _, pass := range s.Passes {
+		auth = append(auth, "password "+maskSecret(pass))
+	}
+	if s.PassCommand != "" {
+		auth = append(auth, "password (pass_cmd: "+s.PassCommand+")")
+	}
+
+	keys := []string{}
+	if s.Key != "" {
+		keyPass := s.KeyPass
+		if s.KeyPassCommand != "" {
+			keyPass = "keypass_cmd: " + s.KeyPassCommand
+		}
+		keys = append(keys, s.Key+"::"+keyPass)
+	}
+	keys = append(keys, s.Keys...)
+	for _, key := range keys {
+		pair := strings.SplitN(key, "::", 2)
+		a := "publickey " + pair[0]
+		if len(pair) > 1 && pair[1] != "" {
+			a += " (passphrase " + maskSecret(pair[1]) + ")"
+		}
+		auth = append(auth, a)
+	}
+
+	if s.KeyCommand != "" {
+		auth = append(auth, "publickey (keycmd: "+s.KeyCommand+")")
+	}
+
+	if s.Cert != "" {
+		a := "certificate " + s.Cert
+		if s.CertPKCS11 {
+			a += " (pkcs11 " + s.PKCS11Provider + ")"
+		} else {
+			a += " (key " + s.CertKey + ")"
+		}
+		auth = append(auth, a)
+	}
+
+	if s.PKCS11Use {
+		auth = append(auth, "pkcs11 "+s.PKCS11Provider)
+	}
+
+	if s.AgentAuth {
+		auth = append(auth, "ssh-agent")
+	}
+
+	return
+}
+
+// getPreviewForwards returns the port forwards of server config.
+func getPreviewForwards(s conf.ServerConfig) (forwards []string) {
+	values := s.PortForwards
+	if s.PortForwardLocal != "" && s.PortForwardRemote != "" {
+		mode := s.PortForwardMode
+		if mode == "" {
+			mode = "L"
+		}
+		values = append([]string{mode + ":" + s.PortForwardLocal + ":" + s.PortForwardRemote}, values...)
+	}
+
+	for _, value := range values {
+		fw, err := conf.ParsePortForward(value)
+		if err != nil {
+			forwards = append(forwards, "error: "+err.Error())
+			continue
+		}
+
+		switch fw.Mode {
+		case "L":
+			forwards = append(forwards, "L "+fw.Local+" => "+fw.Remote)
+		case "R":
+			forwards = append(forwards, "R "+fw.Remote+" => "+fw.Local)
+		}
+	}
+
+	dynamics := []struct {
+		name  string
+		value string
+	}{
+		{"D", s.DynamicPortForward},
+		{"R (dynamic)", s.ReverseDynamicPortForward},
+		{"D (http)", s.HTTPDynamicPortForward},
+		{"R (http)", s.HTTPReverseDynamicPortForward},
+		{"D (nfs)", s.NFSDynamicForwardPort},
+		{"R (nfs)", s.NFSReverseDynamicForwardPort},
+	}
+	for _, d := range dynamics {
+		if d.value != "" {
+			forwards = append(forwards, d.name+" "+d.value)
+		}
+	}
+
+	if s.SSHAgentUse {
+		forwards = append(forwards, "ssh-agent")
+	}
+	if s.X11 || s.X11Trusted {
+		forwards = append(forwards, "X11")
+	}
+
+	return
+}
+
+// maskSecret returns the masked secret. The references (`vault:`, `${env:}`) are shown as is.
+func maskSecret(value string) string {
+	if conf.IsVaultReference(value) || strings.HasPrefix(value, "${env:") {
+		return value
+	}
+
+	return previewMask
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of selecting the servers without TUI, by the command line options.
+//   - `-H` ... server names, `@group`, and patterns (glob or `/regex/`)
+//   - `--select` ... filter expression, matched in the same way as the list view (fuzzy match)
+//   - `-x` ... excludes (server names, `@group`, and patterns)
+
+package list
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+)
+
+// SelectHosts returns the servers selected by hosts (`-H`), expression (`--select`) and excludes (`-x`).
+// expression is matched with fuzzy match, as the list view starts in fuzzy mode.
+// remains is names without excludes, that is used in the list view if no server is selected.
+// filtered is true if the servers are selected by pattern, expression or excludes.
+// In that case, the selected servers should be shown before running (see ConfirmHosts).
+func SelectHosts(data conf.Config, names, hosts []string, expression string, excludes []string) (selected, remains []string, filtered bool, err error) {
+	filtered = expression != "" || len(excludes) > 0
+	for _, host := range hosts {
+		if conf.IsHostPattern(host) {
+			filtered = true
+		}
+	}
+
+	// expand group (@group) and pattern in hosts
+	selected, err = data.ExpandHosts(hosts)
+	if err != nil {
+		return
+	}
+
+	remains, err = data.ExcludeHosts(names, excludes)
+	if err != nil {
+		return
+	}
+
+	// filter expression
+	if expression != "" {
+		l := new(ListInfo)
+		l.NameList = remains
+		l.DataList = data
+		l.Fuzzy = true // the list view starts in fuzzy mode
+
+		matched := l.Filter(expression)
+		if len(matched) == 0 {
+			err = fmt.Errorf("no server matches '%s'", expression)
+			return
+		}
+
+		selected = append(selected, matched...)
+	}
+
+	if len(selected) == 0 {
+		return
+	}
+
+	selected, err = data.ExcludeHosts(selected, excludes)
+	if err != nil {
+		return
+	}
+
+	if len(selected) == 0 {
+		err = fmt.Errorf("all servers are excluded")
+		return
+	}
+
+	selected = common.GetUniqueSlice(selected)
+
+	return
+}
+
+// ConfirmHosts print the selected servers to stderr.
+// If confirm is true, ask whether to continue from /dev/tty.
+func ConfirmHosts(hosts []string, confirm bool) (ok bool, err error) {
+	fmt.Fprintf(os.Stderr, "Selected %d server(s):\n", len(hosts))
+	for _, host := range hosts {
+		fmt.Fprintf(os.Stderr, "  %s\n", host)
+	}
+
+	if !confirm {
+		return true, nil
+	}
+
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false, err
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(os.Stderr, "Are you sure you want to continue (yes/no)? ")
+
+	rd := bufio.NewReader(tty)
+	for {
+		answer, err := rd.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("failed to read answer: %s", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "yes", "y":
+			return true, nil
+		case "no", "n":
+			return false, nil
+		}
+
+		fmt.Fprintf(os.Stderr, "Please type 'yes' or 'no': ")
+	}
+}
@@ -6,6 +6,7 @@ package output
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"io"
 	"math/rand"
@@ -21,9 +22,20 @@ import (
 	"github.com/vbauerster/mpb/decor"
 )
 
+const (
+	// output stream name
+	STREAM_STDOUT = "stdout"
+	STREAM_STDERR = "stderr"
+	STREAM_RESULT = "result"
+)
+
+// writeMutex serializes writing of JSON Lines from multiple servers.
+var writeMutex = new(sync.Mutex)
+
 // Output struct. command execute and lssh-shell mode output data.
 type Output struct {
-	// Template variable value (in unimplemented).
+	// Template variable value.
+	// The time values are evaluated at each output line.
 	//     - ${COUNT}  ... Count value(int)
 	//     - ${SERVER} ... Server Name
 	//     - ${ADDR}   ... Address
@@ -48,6 +60,10 @@ type Output struct {
 	// Count value. ${COUNT}
 	Count int
 
+	// CountLines is increment Count at each output line (command mode).
+	// If false, Count is set by the caller (pshell).
+	CountLines bool
+
 	// Selected Server list
 	ServerList []string
 
@@ -65,6 +81,39 @@ type Output struct {
 	// Auto Colorize flag
 	// TODO(blacknon): colormodeに応じて、パイプ経由だった場合は色分けしないなどの対応ができるように条件分岐する(v0.6.2)
 	AutoColor bool
+
+	// Writer is output destination of Printer.
+	// If nil, print to os.Stdout.
+	Writer io.Writer
+
+	// JSON is print output in JSON Lines format.
+	JSON bool
+
+	// wg is wait the Printers started by NewWriter.
+	wg sync.WaitGroup
+
+	// m is lock of Count, used by Printers of stdout and stderr.
+	m sync.Mutex
+}
+
+// jsonLine is a line of output in JSON Lines format.
+type jsonLine struct {
+	Host      string `json:"host"`
+	Address   string `json:"address"`
+	Stream    string `json:"stream"`
+	Timestamp string `json:"timestamp"`
+	Text      string `json:"text"`
+}
+
+// jsonResult is a result of server in JSON Lines format.
+type jsonResult struct {
+	Host       string  `json:"host"`
+	Address    string  `json:"address"`
+	Stream     string  `json:"stream"`
+	Timestamp  string  `json:"timestamp"`
+	ExitStatus int     `json:"exit_status"`
+	Duration   float64 `json:"duration"`
+	Error      string  `json:"error,omitempty"`
 }
 
 // Create template, set variable value.
@@ -94,48 +143,137 @@ func (o *Output) Create(server string) {
 // GetPrompt update variable value
 func (o *Output) GetPrompt() (p string) {
 	// Get time
+	now := time.Now()
 
 	// replace variable value
 	p = strings.Replace(o.Prompt, "${COUNT}", strconv.Itoa(o.Count), -1)
+	p = strings.Replace(p, "${DATE}", now.Format("2006/01/02"), -1)
+	p = strings.Replace(p, "${YEAR}", now.Format("2006"), -1)
+	p = strings.Replace(p, "${MONTH}", now.Format("01"), -1)
+	p = strings.Replace(p, "${DAY}", now.Format("02"), -1)
+	p = strings.Replace(p, "${TIME}", now.Format("15:04:05"), -1)
+	p = strings.Replace(p, "${HOUR}", now.Format("15"), -1)
+	p = strings.Replace(p, "${MINUTE}", now.Format("04"), -1)
+	p = strings.Replace(p, "${SECOND}", now.Format("05"), -1)
 	return
 }
 
+// nextPrompt return the prompt of next output line.
+// If CountLines is true, Count is incremented.
+func (o *Output) nextPrompt() string {
+	o.m.Lock()
+	defer o.m.Unlock()
+
+	if o.CountLines {
+		o.Count += 1
+	}
+
+	return o.GetPrompt()
+}
+
 // NewWriter return io.WriteCloser at Output printer.
 func (o *Output) NewWriter() (writer *io.PipeWriter) {
+	return o.NewStreamWriter(STREAM_STDOUT)
+}
+
+// NewStreamWriter return io.WriteCloser at Output printer, with stream name (stdout or stderr).
+// The stream name is used in JSON Lines format.
+func (o *Output) NewStreamWriter(stream string) (writer *io.PipeWriter) {
 	// create io.PipeReader, io.PipeWriter
 	r, w := io.Pipe()
 
-	// run output.Printer()
-	go o.Printer(r)
+	// run output.StreamPrinter()
+	o.wg.Add(1)
+	go func() {
+		defer o.wg.Done()
+		o.StreamPrinter(r, stream)
+	}()
 
 	// return writer
 	return w
 }
 
+// Wait blocks until all Printers started by NewWriter are finished.
+// The writers must be closed before Wait.
+func (o *Output) Wait() {
+	o.wg.Wait()
+}
+
 // Printer output stdout from reader.
+// It returns when the reader is closed.
 func (o *Output) Printer(reader io.ReadCloser) {
+	o.StreamPrinter(reader, STREAM_STDOUT)
+}
+
+// StreamPrinter output stream from reader.
+// It returns when the reader is closed.
+func (o *Output) StreamPrinter(reader io.ReadCloser, stream string) {
+	// set writer
+	var writer io.Writer = os.Stdout
+	if o.Writer != nil {
+		writer = o.Writer
+	}
+
 	sc := bufio.NewScanner(reader)
-loop:
-	for {
-		for sc.Scan() {
-			text := sc.Text()
-			if (len(o.ServerList) > 1 && !o.DisableHeader) || o.EnableHeader {
-				oPrompt := o.GetPrompt()
-				fmt.Printf("%s %s\n", oPrompt, text)
-			} else {
-				fmt.Printf("%s\n", text)
-			}
+	for sc.Scan() {
+		text := sc.Text()
+		switch {
+		case o.JSON:
+			o.printJSON(writer, jsonLine{
+				Host:      o.Server,
+				Address:   o.Conf.Addr,
+				Stream:    stream,
+				Timestamp: time.Now().Format(time.RFC3339Nano),
+				Text:      text,
+			})
+
+		case (len(o.ServerList) > 1 && !o.DisableHeader) || o.EnableHeader:
+			oPrompt := o.nextPrompt()
+			fmt.Fprintf(writer, "%s %s\n", oPrompt, text)
+
+		default:
+			fmt.Fprintf(writer, "%s\n", text)
 		}
+	}
+}
 
-		if sc.Err() == io.ErrClosedPipe {
-			break loop
-		}
+// PrintResult print the exit status and duration of server in JSON Lines format.
+// If not JSON format, it prints nothing.
+func (o *Output) PrintResult(exitStatus int, duration time.Duration, err error) {
+	if !o.JSON {
+		return
+	}
 
-		select {
-		case <-time.After(50 * time.Millisecond):
-			continue
-		}
+	var writer io.Writer = os.Stdout
+	if o.Writer != nil {
+		writer = o.Writer
+	}
+
+	result := jsonResult{
+		Host:       o.Server,
+		Address:    o.Conf.Addr,
+		Stream:     STREAM_RESULT,
+		Timestamp:  time.Now().Format(time.RFC3339Nano),
+		ExitStatus: exitStatus,
+		Duration:   duration.Seconds(),
+	}
+	if err != nil {
+		result.Error = err.Error()
 	}
+
+	o.printJSON(writer, result)
+}
+
+// printJSON print v as a line of JSON.
+func (o *Output) printJSON(writer io.Writer, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	writeMutex.Lock()
+	defer writeMutex.Unlock()
+	fmt.Fprintf(writer, "%s\n", data)
 }
 
 // ProgressPrinter return print out progress bar
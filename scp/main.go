@@ -86,6 +86,7 @@ func (cp *Scp) Start() {
 	cp.Run = new(sshl.Run)
 	cp.Run.ServerList = slist
 	cp.Run.Conf = cp.Config
+	cp.Run.Mode = "scp"
 	cp.Run.CreateAuthMethodMap()
 
 	// Create Progress bar struct
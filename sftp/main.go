@@ -92,6 +92,7 @@ func (r *RunSftp) Start() {
 	r.Run = new(sshl.Run)
 	r.Run.ServerList = r.SelectServer
 	r.Run.Conf = r.Config
+	r.Run.Mode = "sftp"
 	r.Run.CreateAuthMethodMap()
 
 	// Default local umask(022).
@@ -21,6 +21,12 @@ const SSH_AUTH_SOCK = "SSH_AUTH_SOCK"
 func (r *Run) CreateAuthMethodMap() {
 	srvs := r.ServerList
 	for _, server := range r.ServerList {
+		// resolve secrets of server and proxies
+		err := r.resolveConfig(server)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+
 		proxySrvs, _ := getProxyRoute(server, r.Conf)
 
 		for _, proxySrv := range proxySrvs {
@@ -92,7 +98,8 @@ func (r *Run) CreateAuthMethodMap() {
 
 		// Certificate
 		if config.Cert != "" {
-			keySigner, err := sshlib.CreateSignerPublicKeyPrompt(config.CertKey, config.CertKeyPass)
+			certKeyPass := r.getAuthSecret(AuthKey{AUTHKEY_KEY, config.CertKey}, config.CertKeyPass)
+			keySigner, err := sshlib.CreateSignerPublicKeyPrompt(config.CertKey, certKeyPass)
 			if err != nil {
 				fmt.Fprintln(os.Stderr, err)
 				continue
@@ -124,6 +131,47 @@ func (r *Run) CreateAuthMethodMap() {
 	}
 }
 
+// resolveConfig resolve `${env:VAR}`, `*_cmd` fields and `vault:` references in the config of server and its proxy route.
+// The proxy route is got again until it does not change, because the proxy name may be resolved.
+func (r *Run) resolveConfig(server string) (err error) {
+	if err = r.Conf.ResolveServerConfig(server); err != nil {
+		return
+	}
+
+	prev := ""
+	for {
+		proxyRoute, err := getProxyRoute(server, r.Conf)
+		if err != nil {
+			return err
+		}
+
+		names := []string{}
+		for _, p := range proxyRoute {
+			names = append(names, p.Type+":"+p.Name)
+		}
+		key := strings.Join(names, ",")
+		if key == prev {
+			return nil
+		}
+		prev = key
+
+		for _, p := range proxyRoute {
+			switch p.Type {
+			case "http", "https", "socks", "socks5":
+				err = r.Conf.ResolveProxyConfig(p.Name)
+			case "command":
+				continue
+			default:
+				err = r.Conf.ResolveServerConfig(p.Name)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
 func (r *Run) SetupSshAgent() {
 	// Connect ssh-agent
 	r.agent = sshlib.ConnectSshAgent()
@@ -147,6 +195,7 @@ func (r *Run) registAuthMapPublicKey(server, key, password string) (err error) {
 
 	if _, ok := r.authMethodMap[authKey]; !ok {
 		// Create signer with key input
+		password = r.getAuthSecret(authKey, password)
 		signer, err := sshlib.CreateSignerPublicKeyPrompt(key, password)
 		if err != nil {
 			return err
@@ -242,6 +291,7 @@ func (r *Run) registAuthMapPKCS11(server, provider, pin string) (err error) {
 		// Create Signer with key input
 		// TODO(blacknon): あとでいい感じに記述する(retry対応)
 		// signers, err := sshlib.CreateSignerPKCS11Prompt(provider, pin)
+		pin = r.getAuthSecret(authKey, pin)
 		signers, err := sshlib.CreateSignerPKCS11(provider, pin)
 
 		if err != nil {
@@ -0,0 +1,307 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the background mode (-f).
+//
+// Go can not fork after authentication, so the background process is started
+// as a new process (marked as go-daemon child). The passphrases and PINs entered in the foreground
+// (and the vault passphrase) are passed to the background process through an inherited pipe,
+// so that it can authenticate without a terminal. They are not passed with the environment variables,
+// that can be read from /proc/<pid>/environ while the process is running.
+
+package ssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/blacknon/lssh/conf"
+	"github.com/sevlyar/go-daemon"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// file descriptors of the background process, passed from the parent process.
+const (
+	// backgroundPipeFd is the pipe, that the parent process writes backgroundInit.
+	backgroundPipeFd = 3
+
+	// backgroundPidFileFd is the pid file, locked by the parent process.
+	backgroundPidFileFd = 4
+)
+
+// authSecret is passphrase or PIN entered in the foreground.
+type authSecret struct {
+	Key  AuthKey
+	Pass string
+}
+
+// backgroundInit is the data passed to the background process through the pipe.
+type backgroundInit struct {
+	PidFile string
+	Secrets []authSecret
+}
+
+// startBackgroundMode check the connection in the foreground, and start the background process.
+// This function is run in the parent process, after r.CreateAuthMethodMap().
+func (r *Run) startBackgroundMode() (err error) {
+	server := r.ServerList[0]
+
+	// check connect (with host key verification)
+	connect, err := r.CreateSshConnect(server)
+	if err != nil {
+		return
+	}
+	r.closeSshConnect(connect)
+
+	// pid file. it is locked until the background process exits.
+	pidFile, err := r.getPidFilePath(server)
+	if err != nil {
+		return
+	}
+
+	lock, err := daemon.OpenLockFile(pidFile, 0600)
+	if err != nil {
+		return
+	}
+	defer lock.Close()
+
+	err = lock.Lock()
+	if err != nil {
+		if errors.Is(err, daemon.ErrWouldBlock) {
+			err = fmt.Errorf("Error: pid file %s is locked. background process is already running.", pidFile)
+		}
+		return
+	}
+
+	// secrets
+	data := backgroundInit{PidFile: pidFile}
+	for key, pass := range r.authSecrets {
+		data.Secrets = append(data.Secrets, authSecret{Key: key, Pass: pass})
+	}
+	if conf.VaultPassphrase != "" {
+		data.Secrets = append(data.Secrets, authSecret{Key: AuthKey{AUTHKEY_VAULT, ""}, Pass: conf.VaultPassphrase})
+	}
+
+	rpipe, wpipe, err := os.Pipe()
+	if err != nil {
+		return
+	}
+	defer rpipe.Close()
+	defer wpipe.Close()
+
+	null, err := os.Open(os.DevNull)
+	if err != nil {
+		return
+	}
+	defer null.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		return
+	}
+
+	// child process. selected server is passed with `-H`.
+	cmd := exec.Command(exe, append([]string{"-H", server}, os.Args[1:]...)...)
+	cmd.Args[0] = os.Args[0]
+	cmd.Env = append(os.Environ(), daemon.MARK_NAME+"="+daemon.MARK_VALUE)
+	cmd.Stdin = null
+	cmd.Stdout = null
+	cmd.Stderr = null
+	cmd.ExtraFiles = []*os.File{rpipe, lock.File} // backgroundPipeFd, backgroundPidFileFd
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+
+	err = cmd.Start()
+	if err != nil {
+		lock.Remove()
+		return
+	}
+	rpipe.Close()
+
+	// pass the secrets, and close the pipe.
+	err = json.NewEncoder(wpipe).Encode(data)
+	if err != nil {
+		cmd.Process.Kill()
+		lock.Remove()
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "Background    :pid %d (pid file: %s)\n", cmd.Process.Pid, pidFile)
+
+	return
+}
+
+// startBackgroundChild initialize the background process.
+// This function is run in the child process, before r.CreateAuthMethodMap().
+func (r *Run) startBackgroundChild() (err error) {
+	// read the secrets from the pipe, and close it.
+	pipe := os.NewFile(backgroundPipeFd, "pipe")
+	data := backgroundInit{}
+	err = json.NewDecoder(pipe).Decode(&data)
+	pipe.Close()
+	if err != nil {
+		return
+	}
+
+	r.authSecrets = map[AuthKey]string{}
+	for _, s := range data.Secrets {
+		if s.Key.Type == AUTHKEY_VAULT {
+			conf.VaultPassphrase = s.Pass
+			continue
+		}
+		r.authSecrets[s.Key] = s.Pass
+	}
+
+	// write pid file
+	r.pidFile = daemon.NewLockFile(os.NewFile(backgroundPidFileFd, data.PidFile))
+	err = r.pidFile.WritePid()
+	if err != nil {
+		return
+	}
+
+	// remove pid file at kill
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		<-sig
+		r.releaseBackground()
+		os.Exit(0)
+	}()
+
+	return
+}
+
+// releaseBackground remove the pid file of background process.
+func (r *Run) releaseBackground() {
+	if r.pidFile != nil {
+		r.pidFile.Remove()
+	}
+}
+
+// getPidFilePath return the pid file path of background mode.
+// If r.PidFile is not set, use `${XDG_RUNTIME_DIR}/lssh/<server>.pid` or `${TMPDIR}/lssh-<uid>/<server>.pid`.
+func (r *Run) getPidFilePath(server string) (path string, err error) {
+	if r.PidFile != "" {
+		path = getAbsPath(r.PidFile)
+		return
+	}
+
+	usr, _ := user.Current()
+
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir != "" {
+		dir = filepath.Join(dir, "lssh")
+	} else {
+		dir = filepath.Join(os.TempDir(), "lssh-"+usr.Uid)
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return
+	}
+
+	path = filepath.Join(dir, getFileName(server)+".pid")
+
+	return
+}
+
+// getAuthSecret return the passphrase or PIN of key in background mode.
+// In the parent process, it is entered from the terminal and kept in r.authSecrets.
+// In the child process, it is taken from r.authSecrets.
+// If not background mode or pass is set, it returns pass.
+func (r *Run) getAuthSecret(key AuthKey, pass string) string {
+	if !r.IsBackground || pass != "" {
+		return pass
+	}
+
+	if s, ok := r.authSecrets[key]; ok {
+		return s
+	}
+
+	if daemon.WasReborn() {
+		return pass
+	}
+
+	switch key.Type {
+	case AUTHKEY_KEY:
+		data, err := os.ReadFile(getAbsPath(key.Value))
+		if err != nil {
+			return pass
+		}
+
+		// check encrypted
+		_, err = ssh.ParsePrivateKey(data)
+		var missingErr *ssh.PassphraseMissingError
+		if !errors.As(err, &missingErr) {
+			return pass
+		}
+
+		for i := 0; i < 3; i++ {
+			input, err := readSecret(key.Value + "'s passphrase:")
+			if err != nil {
+				return pass
+			}
+
+			_, err = ssh.ParsePrivateKeyWithPassphrase(data, []byte(input))
+			if err == nil {
+				pass = input
+				break
+			}
+			fmt.Fprintln(os.Stderr, err)
+		}
+
+	case AUTHKEY_PKCS11:
+		input, err := readSecret(key.Value + "'s PIN:")
+		if err != nil {
+			return pass
+		}
+		pass = input
+	}
+
+	if r.authSecrets == nil {
+		r.authSecrets = map[AuthKey]string{}
+	}
+	if pass != "" {
+		r.authSecrets[key] = pass
+	}
+
+	return pass
+}
+
+// readSecret read the input without echo from /dev/tty.
+func readSecret(msg string) (input string, err error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return
+	}
+	defer tty.Close()
+
+	fmt.Fprint(os.Stderr, msg)
+	result, err := terminal.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return
+	}
+
+	return string(result), nil
+}
+
+// getAbsPath return the absolute path, with `~` replaced by home directory.
+func getAbsPath(path string) string {
+	usr, _ := user.Current()
+	if strings.HasPrefix(path, "~") {
+		path = strings.Replace(path, "~", usr.HomeDir, 1)
+	}
+
+	path, _ = filepath.Abs(path)
+	return path
+}
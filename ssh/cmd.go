@@ -12,6 +12,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/blacknon/go-sshlib"
@@ -20,17 +21,79 @@ import (
 
 var cmdOPROMPT = "${SERVER} :: "
 
+const (
+	// output format of command mode (--output option).
+	OUTPUT_FORMAT_TEXT = "text"
+	OUTPUT_FORMAT_JSON = "json"
+)
+
+// cmdConnect is connection of each server in command mode.
+type cmdConnect struct {
+	Server string
+	Output *output.Output
+	Start  time.Time
+	Err    error
+
+	*sshlib.Connect
+
+	// writers of Output
+	stdout io.WriteCloser
+	stderr io.WriteCloser
+
+	// output files (--output-dir)
+	files *cmdOutputFiles
+
+	// output buffer (--aggregate)
+	buffer *cmdBuffer
+}
+
+// finish close the connection, and print the result of server.
+func (c *cmdConnect) finish(result *cmdResult) {
+	c.close()
+
+	// keep the output in aggregate mode
+	if c.buffer != nil {
+		result.Output = c.buffer.Bytes()
+	}
+
+	// wait the output, and print result.
+	c.Output.Wait()
+	c.Output.PrintResult(result.ExitStatus, result.Duration(), result.Err)
+
+	// write result to output files
+	if c.files != nil {
+		c.files.writeResult(result)
+	}
+}
+
+// close close the output writers and connection.
+func (c *cmdConnect) close() {
+	if c.stdout != nil {
+		c.stdout.Close()
+	}
+	if c.stderr != nil {
+		c.stderr.Close()
+	}
+	if c.Connect != nil && c.Client != nil {
+		c.Client.Close()
+	}
+}
+
 // cmd is run command.
 func (r *Run) cmd() (err error) {
 	// command
 	command := strings.Join(r.ExecCmd, " ")
 
-	// create connect map
-	connmap := map[string]*sshlib.Connect{}
+	// command results
+	results := newCmdResults()
 
-	// make channel
-	finished := make(chan bool)
-	exitInput := make(chan bool)
+	// create output directory
+	if r.OutputDir != "" {
+		err = os.MkdirAll(r.OutputDir, 0755)
+		if err != nil {
+			return
+		}
+	}
 
 	// print header
 	r.PrintSelectServer()
@@ -39,209 +102,484 @@ func (r *Run) cmd() (err error) {
 		r.printProxy(r.ServerList[0])
 	}
 
-	// Create sshlib.Connect to connmap
-	for _, server := range r.ServerList {
-		// check count AuthMethod
-		if len(r.serverAuthMethodMap[server]) == 0 {
-			fmt.Fprintf(os.Stderr, "Error: %s is No AuthMethod.\n", server)
-			continue
+	// run command
+	if len(r.ServerList) == 1 {
+		r.cmdSingle(command, results)
+	} else {
+		r.cmdMulti(command, results)
+	}
+
+	// sleep
+	time.Sleep(300 * time.Millisecond)
+
+	// print aggregated output
+	if r.Aggregate {
+		r.printAggregate(results)
+	}
+
+	// print summary, and set exit code
+	if len(r.ServerList) > 1 {
+		results.printSummary(r.ServerList)
+	}
+	r.ExitCode = results.exitCode(r.ServerList, r.ExitPolicy)
+
+	return
+}
+
+// cmdSingle run command at single server, with port forwarding.
+func (r *Run) cmdSingle(command string, results *cmdResults) {
+	server := r.ServerList[0]
+	config := r.Conf.Server[server]
+
+	c := r.createCmdConnect(server)
+	if c.Err != nil {
+		c.finish(results.add(server, c.Start, c.Err))
+		return
+	}
+
+	// set port forwarding
+	config = r.setPortForwards(server, config)
+
+	// OverWrite dynamic port forwarding
+	if r.DynamicPortForward != "" {
+		config.DynamicPortForward = r.DynamicPortForward
+	}
+
+	// OverWrite reverse dynamic port forwarding
+	if r.ReverseDynamicPortForward != "" {
+		config.ReverseDynamicPortForward = r.ReverseDynamicPortForward
+	}
+
+	// OverWrite http dynamic port forwarding
+	if r.HTTPDynamicPortForward != "" {
+		config.HTTPDynamicPortForward = r.HTTPDynamicPortForward
+	}
+
+	// OverWrite reverse http dynamic port forwarding
+	if r.HTTPReverseDynamicPortForward != "" {
+		config.HTTPReverseDynamicPortForward = r.HTTPReverseDynamicPortForward
+	}
+
+	// print header
+	for _, fw := range config.Forwards {
+		r.printPortForward(fw.Mode, fw.Local, fw.Remote)
+	}
+
+	// Port Forwarding
+	for _, fw := range config.Forwards {
+		var err error
+
+		// port forwarding
+		switch fw.Mode {
+		case "L", "":
+			err = c.TCPLocalForward(fw.Local, fw.Remote)
+		case "R":
+			err = c.TCPRemoteForward(fw.Local, fw.Remote)
 		}
 
-		// Create sshlib.Connect
-		conn, err := r.CreateSshConnect(server)
 		if err != nil {
-			log.Printf("Error: %s:%s\n", server, err)
-			continue
+			fmt.Fprintln(os.Stderr, err)
 		}
+	}
+
+	// Dynamic Port Forwarding
+	if config.DynamicPortForward != "" {
+		r.printDynamicPortForward(config.DynamicPortForward)
+		go c.TCPDynamicForward("localhost", config.DynamicPortForward)
+	}
 
-		connmap[server] = conn
+	// Reverse Dynamic Port Forwarding
+	if config.ReverseDynamicPortForward != "" {
+		r.printReverseDynamicPortForward(config.ReverseDynamicPortForward)
+		go c.TCPReverseDynamicForward("localhost", config.ReverseDynamicPortForward)
 	}
 
-	// Run command and print loop
-	writers := []io.WriteCloser{}
-	for s, c := range connmap {
-		// set session
-		c.Session, _ = c.CreateSession()
+	// HTTP Dynamic Port Forwarding
+	if config.HTTPDynamicPortForward != "" {
+		r.printHTTPDynamicPortForward(config.HTTPDynamicPortForward)
+		go c.HTTPDynamicForward("localhost", config.HTTPDynamicPortForward)
+	}
 
-		// Get server config
-		config := r.Conf.Server[s]
+	// HTTP Reverse Dynamic Port Forwarding
+	if config.HTTPReverseDynamicPortForward != "" {
+		r.printHTTPReverseDynamicPortForward(config.HTTPReverseDynamicPortForward)
+		go c.HTTPReverseDynamicForward("localhost", config.HTTPReverseDynamicPortForward)
+	}
 
-		// create Output
-		o := &output.Output{
-			Templete:      cmdOPROMPT,
-			Count:         0,
-			ServerList:    r.ServerList,
-			Conf:          r.Conf.Server[s],
-			EnableHeader:  r.EnableHeader,
-			DisableHeader: r.DisableHeader,
-			AutoColor:     true,
+	// NFS Dynamic Forward
+	if r.NFSDynamicForwardPort != "" && r.NFSDynamicForwardPath != "" {
+		config.NFSDynamicForwardPort = r.NFSDynamicForwardPort
+		config.NFSDynamicForwardPath = r.NFSDynamicForwardPath
+		go c.NFSForward("localhost", config.NFSDynamicForwardPort, config.NFSDynamicForwardPath)
+	}
+
+	// NFS Reverse Dynamic Forward
+	if r.NFSReverseDynamicForwardPort != "" && r.NFSReverseDynamicForwardPath != "" {
+		config.NFSReverseDynamicForwardPort = r.NFSReverseDynamicForwardPort
+		config.NFSReverseDynamicForwardPath = r.NFSReverseDynamicForwardPath
+		go c.NFSReverseForward("localhost", config.NFSReverseDynamicForwardPort, config.NFSReverseDynamicForwardPath)
+	}
+
+	// if tty
+	if r.IsTerm {
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+
+		// write output to files, with printing.
+		// with tty, the remote stderr is also output to stdout.
+		if c.files != nil {
+			c.Stdout = io.MultiWriter(os.Stdout, c.files.Stdout)
+			c.Stderr = io.MultiWriter(os.Stderr, c.files.Stderr)
 		}
-		o.Create(s)
+	}
 
-		// set output
-		c.Stdout = o.NewWriter()
-		c.Stderr = o.NewWriter()
+	// run command
+	err := runCommand(c.Connect, command)
+	c.finish(results.add(server, c.Start, err))
+}
 
-		// if single server, setup port forwarding.
-		if len(r.ServerList) == 1 {
-			// set port forwarding
-			config = r.setPortForwards(s, config)
+// cmdMulti run command at multiple servers.
+// Connect up to r.getForks() servers at the same time. In parallel mode (-p), the command is
+// run as soon as connected. Otherwise, it is run in order of r.ServerList, while the next
+// servers are connecting.
+func (r *Run) cmdMulti(command string, results *cmdResults) {
+	forks := r.getForks()
+	sem := make(chan struct{}, forks)
 
-			// OverWrite dynamic port forwarding
-			if r.DynamicPortForward != "" {
-				config.DynamicPortForward = r.DynamicPortForward
-			}
+	// stdin
+	var stdinData []byte
+	var broadcaster *stdinBroadcaster
+	switch {
+	case r.IsParallel:
+		// send stdin to each host that is running, as streaming (ex. `tail -F log | lssh -p cat`).
+		// start after the first servers (up to forks) are started.
+		broadcaster = newStdinBroadcaster(forks)
+		go func() {
+			<-broadcaster.start
+			io.Copy(broadcaster, os.Stdin)
+			broadcaster.Close()
+		}()
+
+	case r.IsStdinPipe:
+		// run in order, send all of stdin to each host.
+		stdinData, _ = ioutil.ReadAll(os.Stdin)
+	}
 
-			// OverWrite reverse dynamic port forwarding
-			if r.ReverseDynamicPortForward != "" {
-				config.ReverseDynamicPortForward = r.ReverseDynamicPortForward
+	// run command function
+	run := func(c *cmdConnect) {
+		if c.Err != nil {
+			if broadcaster != nil {
+				broadcaster.ready()
 			}
+			c.finish(results.add(c.Server, c.Start, c.Err))
+			return
+		}
 
-			// OverWrite http dynamic port forwarding
-			if r.HTTPDynamicPortForward != "" {
-				config.HTTPDynamicPortForward = r.HTTPDynamicPortForward
-			}
+		switch {
+		case len(stdinData) > 0:
+			c.Stdin = bytes.NewReader(stdinData)
+		case broadcaster != nil:
+			c.Stdin = broadcaster.add(c.Server)
+			broadcaster.ready()
+			defer broadcaster.remove(c.Server)
+		}
 
-			// OverWrite reverse http dynamic port forwarding
-			if r.HTTPReverseDynamicPortForward != "" {
-				config.HTTPReverseDynamicPortForward = r.HTTPReverseDynamicPortForward
-			}
+		err := runCommand(c.Connect, command)
+		c.finish(results.add(c.Server, c.Start, err))
+	}
 
-			// OverWrite local bashrc use
-			if r.IsBashrc {
-				config.LocalRcUse = "yes"
-			}
+	// connected channels, used to run in order when not parallel.
+	connected := map[string]chan *cmdConnect{}
+	for _, server := range r.ServerList {
+		connected[server] = make(chan *cmdConnect, 1)
+	}
 
-			// OverWrite local bashrc not use
-			if r.IsNotBashrc {
-				config.LocalRcUse = "no"
-			}
+	wg := new(sync.WaitGroup)
+	wg.Add(len(r.ServerList))
 
-			// print header
-			for _, fw := range config.Forwards {
-				r.printPortForward(fw.Mode, fw.Local, fw.Remote)
-			}
+	// connect in order of r.ServerList, up to forks.
+	go func() {
+		for _, s := range r.ServerList {
+			server := s
+			sem <- struct{}{}
 
-			// Port Forwarding
-			for _, fw := range config.Forwards {
-				// port forwarding
-				switch fw.Mode {
-				case "L", "":
-					err = c.TCPLocalForward(fw.Local, fw.Remote)
-				case "R":
-					err = c.TCPRemoteForward(fw.Local, fw.Remote)
+			go func() {
+				c := r.createCmdConnect(server)
+				if r.IsParallel {
+					run(c)
+					<-sem
+					wg.Done()
+				} else {
+					connected[server] <- c
 				}
+			}()
+		}
+	}()
+
+	// not parallel, run in order.
+	if !r.IsParallel {
+		for _, server := range r.ServerList {
+			c := <-connected[server]
+			run(c)
+			<-sem
+			wg.Done()
+		}
+	}
 
-				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
-				}
-			}
+	wg.Wait()
+}
 
-			// Dynamic Port Forwarding
-			if config.DynamicPortForward != "" {
-				r.printDynamicPortForward(config.DynamicPortForward)
-				go c.TCPDynamicForward("localhost", config.DynamicPortForward)
-			}
+// createCmdConnect connect to server, and create Output.
+// If failed, cmdConnect.Err is set.
+func (r *Run) createCmdConnect(server string) (c *cmdConnect) {
+	c = &cmdConnect{Server: server, Start: time.Now()}
+
+	// create Output
+	c.Output = &output.Output{
+		Templete:      cmdOPROMPT,
+		Count:         0,
+		CountLines:    true,
+		ServerList:    r.ServerList,
+		Conf:          r.Conf.Server[server],
+		EnableHeader:  r.EnableHeader,
+		DisableHeader: r.DisableHeader,
+		AutoColor:     true,
+		JSON:          r.OutputFormat == OUTPUT_FORMAT_JSON,
+	}
+	if r.Conf.Shell.OPrompt != "" {
+		c.Output.Templete = r.Conf.Shell.OPrompt
+	}
+	c.Output.Create(server)
 
-			// Reverse Dynamic Port Forwarding
-			if config.ReverseDynamicPortForward != "" {
-				r.printReverseDynamicPortForward(config.ReverseDynamicPortForward)
-				go c.TCPReverseDynamicForward("localhost", config.ReverseDynamicPortForward)
-			}
+	// create output files
+	if r.OutputDir != "" {
+		files, err := r.createCmdOutputFiles(server)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		} else {
+			c.files = files
+		}
+	}
 
-			// HTTP Dynamic Port Forwarding
-			if config.HTTPDynamicPortForward != "" {
-				r.printHTTPDynamicPortForward(config.HTTPDynamicPortForward)
-				go c.HTTPDynamicForward("localhost", config.HTTPDynamicPortForward)
-			}
+	// check count AuthMethod
+	if len(r.serverAuthMethodMap[server]) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: %s is No AuthMethod.\n", server)
+		c.Err = fmt.Errorf("No AuthMethod")
+		return
+	}
 
-			// HTTP Reverse Dynamic Port Forwarding
-			if config.HTTPReverseDynamicPortForward != "" {
-				r.printHTTPReverseDynamicPortForward(config.HTTPReverseDynamicPortForward)
-				go c.HTTPReverseDynamicForward("localhost", config.HTTPReverseDynamicPortForward)
-			}
+	// Create sshlib.Connect
+	conn, err := r.CreateSshConnect(server)
+	if err != nil {
+		log.Printf("Error: %s:%s\n", server, err)
+		c.Err = err
+		return
+	}
+	c.Connect = conn
+
+	// set output
+	var stdout, stderr io.Writer
+	if r.Aggregate {
+		// buffer the output, it is printed after all servers finished.
+		c.buffer = new(cmdBuffer)
+		stdout = c.buffer
+		stderr = c.buffer
+	} else {
+		c.stdout = c.Output.NewStreamWriter(output.STREAM_STDOUT)
+		c.stderr = c.Output.NewStreamWriter(output.STREAM_STDERR)
+		stdout = c.stdout
+		stderr = c.stderr
+	}
+	c.Stdout = stdout
+	c.Stderr = stderr
 
-			// NFS Dynamic Forward
-			if r.NFSDynamicForwardPort != "" && r.NFSDynamicForwardPath != "" {
-				config.NFSDynamicForwardPort = r.NFSDynamicForwardPort
-				config.NFSDynamicForwardPath = r.NFSDynamicForwardPath
-				go c.NFSForward("localhost", config.NFSDynamicForwardPort, config.NFSDynamicForwardPath)
-			}
+	// write output to files, with printing.
+	if c.files != nil {
+		c.Stdout = io.MultiWriter(stdout, c.files.Stdout)
+		c.Stderr = io.MultiWriter(stderr, c.files.Stderr)
+	}
 
-			// NFS Reverse Dynamic Forward
-			if r.NFSReverseDynamicForwardPort != "" && r.NFSReverseDynamicForwardPath != "" {
-				config.NFSReverseDynamicForwardPort = r.NFSReverseDynamicForwardPort
-				config.NFSReverseDynamicForwardPath = r.NFSReverseDynamicForwardPath
-				go c.NFSReverseForward("localhost", config.NFSReverseDynamicForwardPort, config.NFSReverseDynamicForwardPath)
-			}
+	return
+}
 
-			// if tty
-			if r.IsTerm {
-				c.Stdin = os.Stdin
-				c.Stdout = os.Stdout
-				c.Stderr = os.Stderr
-			}
-		} else {
-			if r.IsParallel {
-				w, _ := c.Session.StdinPipe()
-				writers = append(writers, w)
-			}
+// getForks return the max number of servers connecting at the same time.
+// `--forks` option takes precedence over `[shell] forks` in config. 0 is unlimited.
+func (r *Run) getForks() int {
+	forks := r.Forks
+	if forks <= 0 {
+		forks = r.Conf.Shell.Forks
+	}
+
+	if forks <= 0 || forks > len(r.ServerList) {
+		forks = len(r.ServerList)
+	}
+
+	return forks
+}
+
+// runCommand run command at conn, and return the error of session.Run.
+// Unlike sshlib.Connect.Command, the exit status of remote command can be got from the error.
+func runCommand(conn *sshlib.Connect, command string) (err error) {
+	// create session
+	session := conn.Session
+	if session == nil {
+		session, err = conn.CreateSession()
+		if err != nil {
+			return
 		}
 	}
+	defer func() { conn.Session = nil }()
 
-	// if parallel flag true, and select server is not single,
-	// set send stdin.
-	var stdinData []byte
+	// Set Stdin
 	switch {
-	case r.IsParallel && len(r.ServerList) > 1:
-		go output.PushInput(exitInput, writers, os.Stdin)
+	case conn.Stdin != nil:
+		session.Stdin = conn.Stdin
+	default:
+		session.Stdin = sshlib.GetStdin()
+	}
 
-	case !r.IsParallel && len(r.ServerList) > 1:
-		if r.IsStdinPipe {
-			stdinData, _ = ioutil.ReadAll(os.Stdin)
-		}
+	// Set Stdout, Stderr
+	session.Stdout = os.Stdout
+	if conn.Stdout != nil {
+		session.Stdout = conn.Stdout
 	}
 
-	// run command
-	for _, c := range connmap {
-		conn := c
-		if r.IsParallel {
-			go func() {
-				conn.Command(command)
-				finished <- true
-			}()
-		} else {
-			if len(stdinData) > 0 {
-				// get stdin
-				rd := bytes.NewReader(stdinData)
-				w, _ := conn.Session.StdinPipe()
-
-				// run command
-				go func() {
-					conn.Command(command)
-					finished <- true
-				}()
-
-				// send stdin
-				io.Copy(w, rd)
-				w.Close()
-			} else {
-				// run command
-				conn.Command(command)
-				go func() { finished <- true }()
-			}
+	session.Stderr = os.Stderr
+	if conn.Stderr != nil {
+		session.Stderr = conn.Stderr
+	}
+
+	// Request tty
+	if conn.TTY {
+		err = sshlib.RequestTty(session)
+		if err != nil {
+			return
 		}
 	}
 
-	// wait
-	for i := 0; i < len(connmap); i++ {
-		<-finished
+	// ssh agent forwarding
+	if conn.ForwardAgent {
+		conn.ForwardSshAgent(session)
 	}
 
-	close(exitInput)
+	// x11 forwarding
+	if conn.ForwardX11 {
+		if err := conn.X11Forward(session); err != nil {
+			log.Println(err)
+		}
+	}
 
-	// sleep
-	time.Sleep(300 * time.Millisecond)
+	// Run Command
+	err = session.Run(command)
 
 	return
 }
+
+// stdinBroadcaster send the input to the stdin of all running commands.
+// Used in parallel mode (-p), where servers start at different times.
+type stdinBroadcaster struct {
+	m       *sync.Mutex
+	readers map[string]*io.PipeReader
+	writers map[string]*io.PipeWriter
+	closed  bool
+
+	// start is closed when the first waiting servers are ready.
+	start   chan struct{}
+	waiting int
+}
+
+// newStdinBroadcaster return stdinBroadcaster, that waits for wait servers to be ready.
+func newStdinBroadcaster(wait int) *stdinBroadcaster {
+	b := &stdinBroadcaster{
+		m:       new(sync.Mutex),
+		readers: map[string]*io.PipeReader{},
+		writers: map[string]*io.PipeWriter{},
+		start:   make(chan struct{}),
+		waiting: wait,
+	}
+	if wait <= 0 {
+		close(b.start)
+	}
+
+	return b
+}
+
+// ready count down the waiting servers (connected or failed).
+// When all waiting servers are ready, b.start is closed.
+func (b *stdinBroadcaster) ready() {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	if b.waiting > 0 {
+		b.waiting--
+		if b.waiting == 0 {
+			close(b.start)
+		}
+	}
+}
+
+// add return the stdin reader of server.
+func (b *stdinBroadcaster) add(server string) io.Reader {
+	r, w := io.Pipe()
+
+	b.m.Lock()
+	if b.closed {
+		// input is already ended.
+		w.Close()
+	} else {
+		b.readers[server] = r
+		b.writers[server] = w
+	}
+	b.m.Unlock()
+
+	return r
+}
+
+// remove stop sending the input to server.
+func (b *stdinBroadcaster) remove(server string) {
+	// close reader first, to unblock the writing.
+	b.m.Lock()
+	r := b.readers[server]
+	b.m.Unlock()
+	if r != nil {
+		r.Close()
+	}
+
+	b.m.Lock()
+	if w, ok := b.writers[server]; ok {
+		w.Close()
+	}
+	delete(b.readers, server)
+	delete(b.writers, server)
+	b.m.Unlock()
+}
+
+// Write write p to all running commands.
+func (b *stdinBroadcaster) Write(p []byte) (n int, err error) {
+	b.m.Lock()
+	writers := []*io.PipeWriter{}
+	for _, w := range b.writers {
+		writers = append(writers, w)
+	}
+	b.m.Unlock()
+
+	for _, w := range writers {
+		w.Write(p)
+	}
+
+	return len(p), nil
+}
+
+// Close send EOF to all running commands, and to the commands added after this.
+func (b *stdinBroadcaster) Close() error {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	b.closed = true
+	for _, w := range b.writers {
+		w.Close()
+	}
+
+	return nil
+}
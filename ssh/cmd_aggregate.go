@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the aggregate output of command mode (--aggregate, --diff).
+// Like dshbak -c, the servers with identical output are grouped and printed once.
+
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// cmdBuffer is the buffer of the output (stdout and stderr) of server in aggregate mode.
+type cmdBuffer struct {
+	m   sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *cmdBuffer) Write(p []byte) (n int, err error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return b.buf.Write(p)
+}
+
+// Bytes return the copy of buffered output.
+func (b *cmdBuffer) Bytes() []byte {
+	b.m.Lock()
+	defer b.m.Unlock()
+	return append([]byte{}, b.buf.Bytes()...)
+}
+
+// cmdOutputGroup is the servers with identical output.
+type cmdOutputGroup struct {
+	Servers []string
+	Output  []byte
+}
+
+// Header return the header of group, like `web[01-03],db02`.
+func (g *cmdOutputGroup) Header() string {
+	return common.CompressHostList(g.Servers)
+}
+
+// groupOutput group the servers of serverList by the output.
+// The servers that failed to connect are not included.
+// Groups are sorted by the number of servers (descending), and the order of first appearance.
+func (c *cmdResults) groupOutput(serverList []string) (groups []*cmdOutputGroup) {
+	groupMap := map[string]*cmdOutputGroup{}
+	for _, server := range serverList {
+		result := c.get(server)
+		if result == nil || result.Err != nil {
+			continue
+		}
+
+		key := string(result.Output)
+		g, ok := groupMap[key]
+		if !ok {
+			g = &cmdOutputGroup{Output: result.Output}
+			groupMap[key] = g
+			groups = append(groups, g)
+		}
+		g.Servers = append(g.Servers, server)
+	}
+
+	sort.SliceStable(groups, func(i, j int) bool {
+		return len(groups[i].Servers) > len(groups[j].Servers)
+	})
+
+	return
+}
+
+// printAggregate print the output of servers grouped by identical output.
+// If r.AggregateDiff is true, the groups other than majority are printed as unified diff against majority.
+func (r *Run) printAggregate(results *cmdResults) {
+	groups := results.groupOutput(r.ServerList)
+	if len(groups) == 0 {
+		return
+	}
+
+	majority := groups[0]
+	for i, g := range groups {
+		printAggregateHeader(g.Header())
+
+		if !r.AggregateDiff || i == 0 {
+			os.Stdout.Write(g.Output)
+			if len(g.Output) > 0 && !bytes.HasSuffix(g.Output, []byte("\n")) {
+				fmt.Fprintln(os.Stdout)
+			}
+			continue
+		}
+
+		diff := difflib.UnifiedDiff{
+			A:        splitLines(majority.Output),
+			B:        splitLines(g.Output),
+			FromFile: majority.Header(),
+			ToFile:   g.Header(),
+			Context:  3,
+		}
+		text, err := difflib.GetUnifiedDiffString(diff)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+			continue
+		}
+		fmt.Fprint(os.Stdout, text)
+	}
+}
+
+// printAggregateHeader print the header of group, like dshbak.
+func printAggregateHeader(header string) {
+	line := strings.Repeat("-", 16)
+	fmt.Fprintf(os.Stdout, "%s\n%s\n%s\n", line, header, line)
+}
+
+// splitLines split the output into lines, with the newline at the end of each line.
+func splitLines(data []byte) (lines []string) {
+	lines = strings.SplitAfter(string(data), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return
+}
@@ -0,0 +1,63 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// cmdOutputFiles is the output files of server in command mode (--output-dir).
+//   - <dir>/<server>.out ... stdout
+//   - <dir>/<server>.err ... stderr (and error of connection)
+//   - <dir>/<server>.rc  ... exit status
+type cmdOutputFiles struct {
+	Stdout *os.File
+	Stderr *os.File
+	rcPath string
+}
+
+// createCmdOutputFiles create the output files of server in r.OutputDir.
+func (r *Run) createCmdOutputFiles(server string) (files *cmdOutputFiles, err error) {
+	base := filepath.Join(r.OutputDir, getFileName(server))
+
+	files = &cmdOutputFiles{rcPath: base + ".rc"}
+
+	files.Stdout, err = os.Create(base + ".out")
+	if err != nil {
+		return
+	}
+
+	files.Stderr, err = os.Create(base + ".err")
+	if err != nil {
+		files.Stdout.Close()
+		return
+	}
+
+	return
+}
+
+// writeResult write the exit status to rc file, and close files.
+// If the connection failed, the error is written to stderr file.
+func (f *cmdOutputFiles) writeResult(result *cmdResult) {
+	if result.Err != nil {
+		fmt.Fprintf(f.Stderr, "%s\n", result.Err)
+	}
+
+	f.Stdout.Close()
+	f.Stderr.Close()
+
+	err := os.WriteFile(f.rcPath, []byte(fmt.Sprintf("%d\n", result.ExitStatus)), 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+}
+
+// getFileName return the server name that can be used as file name.
+func getFileName(server string) string {
+	return strings.NewReplacer("/", "_", ":", "_").Replace(server)
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// exit policy of command mode.
+	//   - any      ... exit non-zero if any server failed (default).
+	//   - all      ... exit non-zero if all servers failed.
+	//   - majority ... exit non-zero if more than half of servers failed.
+	EXIT_POLICY_ANY      = "any"
+	EXIT_POLICY_ALL      = "all"
+	EXIT_POLICY_MAJORITY = "majority"
+)
+
+// exit status, when the remote exit status can not be got (connect error etc).
+const exitStatusError = 255
+
+// cmdResult is the result of command at each server.
+type cmdResult struct {
+	Server string
+
+	// remote exit status.
+	// If connection or session failed, it is 255.
+	ExitStatus int
+
+	// error of connect or session. nil, if the remote command exited (with any status).
+	Err error
+
+	Start time.Time
+	End   time.Time
+
+	// buffered output (stdout and stderr) in aggregate mode.
+	Output []byte
+}
+
+// Duration return the time of connect and run command.
+func (c *cmdResult) Duration() time.Duration {
+	return c.End.Sub(c.Start)
+}
+
+// cmdResults is the results of command mode.
+type cmdResults struct {
+	m       *sync.Mutex
+	results map[string]*cmdResult
+}
+
+func newCmdResults() *cmdResults {
+	return &cmdResults{
+		m:       new(sync.Mutex),
+		results: map[string]*cmdResult{},
+	}
+}
+
+// add the result of server. err is the error of connect or session.Run.
+func (c *cmdResults) add(server string, start time.Time, err error) *cmdResult {
+	result := &cmdResult{
+		Server: server,
+		Start:  start,
+		End:    time.Now(),
+	}
+
+	var exitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		result.ExitStatus = 0
+	case errors.As(err, &exitErr):
+		result.ExitStatus = exitErr.ExitStatus()
+	default:
+		result.ExitStatus = exitStatusError
+		result.Err = err
+	}
+
+	c.m.Lock()
+	c.results[server] = result
+	c.m.Unlock()
+
+	return result
+}
+
+// get return the result of server. If not exist, return nil.
+func (c *cmdResults) get(server string) *cmdResult {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.results[server]
+}
+
+// failed return the failed server list, in order of serverList.
+// The server without result is also failed.
+func (c *cmdResults) failed(serverList []string) (failed []string) {
+	for _, server := range serverList {
+		result := c.get(server)
+		if result == nil || result.ExitStatus != 0 {
+			failed = append(failed, server)
+		}
+	}
+
+	return
+}
+
+// printSummary print the succeeded and failed servers to stderr.
+func (c *cmdResults) printSummary(serverList []string) {
+	succeeded := []string{}
+	failed := []string{}
+
+	for _, server := range serverList {
+		result := c.get(server)
+		switch {
+		case result == nil:
+			failed = append(failed, fmt.Sprintf("%s(not run)", server))
+		case result.Err != nil:
+			failed = append(failed, fmt.Sprintf("%s(%s)", server, result.Err))
+		case result.ExitStatus != 0:
+			failed = append(failed, fmt.Sprintf("%s(exit %d)", server, result.ExitStatus))
+		default:
+			succeeded = append(succeeded, server)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Succeeded     :%d/%d %s\n", len(succeeded), len(serverList), strings.Join(succeeded, ","))
+	fmt.Fprintf(os.Stderr, "Failed        :%d/%d %s\n", len(failed), len(serverList), strings.Join(failed, ","))
+}
+
+// exitCode return the exit code of lssh according to policy.
+// If single server, it returns the remote exit status.
+func (c *cmdResults) exitCode(serverList []string, policy string) int {
+	if len(serverList) == 1 {
+		result := c.get(serverList[0])
+		if result == nil {
+			return exitStatusError
+		}
+		return result.ExitStatus
+	}
+
+	failed := len(c.failed(serverList))
+
+	var isFailed bool
+	switch policy {
+	case EXIT_POLICY_ALL:
+		isFailed = failed == len(serverList)
+	case EXIT_POLICY_MAJORITY:
+		isFailed = failed*2 > len(serverList)
+	default:
+		isFailed = failed > 0
+	}
+
+	if isFailed {
+		return 1
+	}
+
+	return 0
+}
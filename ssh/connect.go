@@ -32,6 +32,14 @@ func (r *Run) CreateSshConnect(server string) (connect *sshlib.Connect, err erro
 	var dialer sshlib.ProxyDialer
 	dialer = proxy.Direct
 
+	// ssh clients of proxy route. they are closed if the connection fails.
+	proxyClients := []*ssh.Client{}
+	defer func() {
+		if err != nil {
+			closeClients(proxyClients)
+		}
+	}()
+
 	// Connect loop proxy server
 	for _, p := range proxyRoute {
 		config := r.Conf
@@ -58,14 +66,16 @@ func (r *Run) CreateSshConnect(server string) (connect *sshlib.Connect, err erro
 		default:
 			c := config.Server[p.Name]
 			pxy := &sshlib.Connect{
-				ProxyDialer: dialer,
+				ProxyDialer:     dialer,
+				HostKeyCallback: r.createHostKeyCallback(p.Name, c),
 			}
 			err := pxy.CreateClient(c.Addr, c.Port, c.User, r.serverAuthMethodMap[p.Name])
 			if err != nil {
-				return connect, err
+				return connect, fmt.Errorf("proxy %s: %s", p.Name, err)
 			}
 
 			dialer = pxy.Client
+			proxyClients = append(proxyClients, pxy.Client)
 		}
 	}
 
@@ -95,21 +105,51 @@ func (r *Run) CreateSshConnect(server string) (connect *sshlib.Connect, err erro
 		ConnectTimeout:        s.ConnectTimeout,
 		SendKeepAliveMax:      s.ServerAliveCountMax,
 		SendKeepAliveInterval: s.ServerAliveCountInterval,
+		HostKeyCallback:       r.createHostKeyCallback(server, s),
 	}
 
 	err = connect.CreateClient(s.Addr, s.Port, s.User, r.serverAuthMethodMap[server])
 
 	if err != nil {
-		if client, ok := dialer.(*ssh.Client); ok {
-			client.Close()
-		}
-
 		return nil, err
 	}
 
+	if len(proxyClients) > 0 {
+		r.proxyMutex.Lock()
+		if r.proxyClients == nil {
+			r.proxyClients = map[*ssh.Client][]*ssh.Client{}
+		}
+		r.proxyClients[connect.Client] = proxyClients
+		r.proxyMutex.Unlock()
+	}
+
+	r.recordHistory(server)
+
 	return connect, nil
 }
 
+// closeSshConnect close the connection of connect, and the proxy route of it.
+func (r *Run) closeSshConnect(connect *sshlib.Connect) {
+	if connect.Client == nil {
+		return
+	}
+
+	r.proxyMutex.Lock()
+	proxyClients := r.proxyClients[connect.Client]
+	delete(r.proxyClients, connect.Client)
+	r.proxyMutex.Unlock()
+
+	connect.Client.Close()
+	closeClients(proxyClients)
+}
+
+// closeClients close the ssh clients of proxy route, from the nearest to the target server.
+func closeClients(clients []*ssh.Client) {
+	for i := len(clients) - 1; i >= 0; i-- {
+		clients[i].Close()
+	}
+}
+
 // proxy struct
 type proxyRouteData struct {
 	Name string
@@ -126,8 +166,18 @@ func getProxyRoute(server string, config conf.Config) (proxyRoute []*proxyRouteD
 	conName = server
 	conType = "ssh"
 
+	// visited proxies, to detect the proxy loop.
+	visited := map[string]bool{}
+
 proxyLoop:
 	for {
+		visitKey := conType + ":" + conName
+		if visited[visitKey] {
+			err = fmt.Errorf("Proxy loop detected : %s (%s)", server, conName)
+			return nil, err
+		}
+		visited[visitKey] = true
+
 		switch conType {
 		case "http", "https", "socks", "socks5":
 			var conConf conf.ProxyConfig
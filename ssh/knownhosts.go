@@ -0,0 +1,213 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+const (
+	HOSTKEY_CHECK_YES       = "yes"
+	HOSTKEY_CHECK_NO        = "no"
+	HOSTKEY_CHECK_ACCEPTNEW = "accept-new"
+	HOSTKEY_CHECK_ASK       = "ask"
+)
+
+// defaultKnownHostsFile is used when known_hosts_files is not set.
+var defaultKnownHostsFile = "~/.ssh/known_hosts"
+
+// knownHostsMutex serializes reading and appending known_hosts files,
+// because connections are created in parallel (lscp, lsftp, lssh -p).
+var knownHostsMutex = new(sync.Mutex)
+
+// createHostKeyCallback return ssh.HostKeyCallback, that verifies the host key of server
+// against the known_hosts files according to strict_host_key_checking.
+//
+// strict_host_key_checking:
+//   - yes        ... unknown and changed keys are error.
+//   - accept-new ... unknown keys are added to the first known_hosts file, changed keys are error.
+//   - no         ... not verify host key.
+//   - ask        ... (default) ask to add unknown keys. When connecting to multiple servers or
+//     stdin is not a terminal, it works the same as `yes`.
+func (r *Run) createHostKeyCallback(server string, config conf.ServerConfig) ssh.HostKeyCallback {
+	mode := strings.ToLower(config.StrictHostKeyChecking)
+	if mode == "" {
+		mode = HOSTKEY_CHECK_ASK
+	}
+
+	if mode == HOSTKEY_CHECK_NO {
+		return ssh.InsecureIgnoreHostKey()
+	}
+
+	files := getKnownHostsFiles(config.KnownHostsFiles)
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+		knownHostsMutex.Lock()
+		defer knownHostsMutex.Unlock()
+
+		err = checkKnownHosts(files, hostname, remote, key)
+		if err == nil {
+			return nil
+		}
+
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) {
+			return fmt.Errorf("host key verification failed: %s", err)
+		}
+
+		fingerprint := ssh.FingerprintSHA256(key)
+
+		// changed host key
+		if len(keyErr.Want) > 0 {
+			want := keyErr.Want[0]
+			return fmt.Errorf("host key verification failed: host key for %s has changed (%s %s), offending key in %s:%d",
+				hostname, key.Type(), fingerprint, want.Filename, want.Line)
+		}
+
+		// unknown host key
+		switch mode {
+		case HOSTKEY_CHECK_ACCEPTNEW:
+			return appendKnownHosts(files[0], hostname, remote, key)
+
+		case HOSTKEY_CHECK_ASK:
+			if r.isHostKeyPrompt() {
+				ok, err := askAddingHostKey(server, hostname, remote, key)
+				if err != nil {
+					return fmt.Errorf("host key verification failed: %s", err)
+				}
+
+				if ok {
+					return appendKnownHosts(files[0], hostname, remote, key)
+				}
+			}
+		}
+
+		return fmt.Errorf("host key verification failed: no host key is known for %s (%s %s)",
+			hostname, key.Type(), fingerprint)
+	}
+}
+
+// isHostKeyPrompt returns whether it can ask to add an unknown host key.
+// Prompt only when connecting to a single server from the terminal.
+func (r *Run) isHostKeyPrompt() bool {
+	if len(common.GetUniqueSlice(r.ServerList)) != 1 {
+		return false
+	}
+
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// getKnownHostsFiles return the absolute paths of known_hosts files.
+func getKnownHostsFiles(paths []string) (files []string) {
+	if len(paths) == 0 {
+		paths = []string{defaultKnownHostsFile}
+	}
+
+	usr, _ := user.Current()
+	for _, p := range paths {
+		if strings.HasPrefix(p, "~") {
+			p = strings.Replace(p, "~", usr.HomeDir, 1)
+		}
+
+		p, _ = filepath.Abs(p)
+		files = append(files, p)
+	}
+
+	return
+}
+
+// checkKnownHosts verifies the host key with exist files in files.
+// If no file exists, it returns *knownhosts.KeyError as unknown host.
+func checkKnownHosts(files []string, hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+	existFiles := []string{}
+	for _, f := range files {
+		if common.IsExist(f) {
+			existFiles = append(existFiles, f)
+		}
+	}
+
+	if len(existFiles) == 0 {
+		return &knownhosts.KeyError{}
+	}
+
+	callback, err := knownhosts.New(existFiles...)
+	if err != nil {
+		return
+	}
+
+	return callback(hostname, remote, key)
+}
+
+// appendKnownHosts append the host key to the known_hosts file.
+func appendKnownHosts(file, hostname string, remote net.Addr, key ssh.PublicKey) (err error) {
+	addrs := []string{knownhosts.Normalize(hostname)}
+	if remoteAddr := knownhosts.Normalize(remote.String()); remoteAddr != addrs[0] {
+		addrs = append(addrs, remoteAddr)
+	}
+
+	err = os.MkdirAll(filepath.Dir(file), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to add host key: %s", err)
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to add host key: %s", err)
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, knownhosts.Line(addrs, key))
+	if err != nil {
+		return fmt.Errorf("failed to add host key: %s", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "Warning: Permanently added '%s' (%s) to the list of known hosts.\n", hostname, key.Type())
+
+	return
+}
+
+// askAddingHostKey ask whether to add an unknown host key, from /dev/tty.
+func askAddingHostKey(server, hostname string, remote net.Addr, key ssh.PublicKey) (bool, error) {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false, err
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(os.Stderr, "The authenticity of host '%s' (%s (%s)) can't be established.\n", server, hostname, remote.String())
+	fmt.Fprintf(os.Stderr, "%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+	fmt.Fprintf(os.Stderr, "Are you sure you want to continue connecting (yes/no)? ")
+
+	rd := bufio.NewReader(tty)
+	for {
+		answer, err := rd.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("failed to read answer: %s", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "yes":
+			return true, nil
+		case "no":
+			return false, nil
+		}
+
+		fmt.Fprintf(os.Stderr, "Please type 'yes' or 'no': ")
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// newTestHostKey return a generated host key.
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	key, err := ssh.NewPublicKey(pub)
+	assert.NoError(t, err)
+
+	return key
+}
+
+func TestCreateHostKeyCallback(t *testing.T) {
+	hostname := "192.168.100.1:22"
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.100.1"), Port: 22}
+
+	key := newTestHostKey(t)
+	otherKey := newTestHostKey(t)
+	knownLine := knownhosts.Line([]string{knownhosts.Normalize(hostname)}, key) + "\n"
+
+	type TestData struct {
+		desc        string
+		mode        string
+		known       string // content of known_hosts. "" is not exist.
+		key         ssh.PublicKey
+		expectErr   string
+		expectWrite bool
+	}
+	tds := []TestData{
+		{desc: "yes: known", mode: "yes", known: knownLine, key: key},
+		{desc: "yes: unknown", mode: "yes", key: key, expectErr: "no host key is known"},
+		{desc: "yes: changed", mode: "yes", known: knownLine, key: otherKey, expectErr: "has changed"},
+		{desc: "accept-new: unknown", mode: "accept-new", key: key, expectWrite: true},
+		{desc: "accept-new: changed", mode: "accept-new", known: knownLine, key: otherKey, expectErr: "has changed"},
+		{desc: "no: unknown", mode: "no", key: key},
+		{desc: "no: changed", mode: "no", known: knownLine, key: otherKey},
+		{desc: "ask: unknown (multiple servers, not prompted)", mode: "ask", key: key, expectErr: "no host key is known"},
+		{desc: "default: changed", mode: "", known: knownLine, key: otherKey, expectErr: "has changed"},
+	}
+	for _, v := range tds {
+		file := filepath.Join(t.TempDir(), "known_hosts")
+		if v.known != "" {
+			assert.NoError(t, os.WriteFile(file, []byte(v.known), 0600), v.desc)
+		}
+
+		// multiple servers, not to prompt in ask mode
+		r := &Run{ServerList: []string{"server", "server2"}}
+		callback := r.createHostKeyCallback("server", conf.ServerConfig{StrictHostKeyChecking: v.mode, KnownHostsFiles: []string{file}})
+
+		err := callback(hostname, remote, v.key)
+		if v.expectErr != "" {
+			assert.Error(t, err, v.desc)
+			assert.Contains(t, err.Error(), v.expectErr, v.desc)
+		} else {
+			assert.NoError(t, err, v.desc)
+		}
+
+		// known_hosts is written only when a new key is accepted
+		data, _ := os.ReadFile(file)
+		if v.expectWrite {
+			assert.Equal(t, knownhosts.Line([]string{knownhosts.Normalize(hostname)}, v.key)+"\n", string(data), v.desc)
+		} else {
+			assert.Equal(t, v.known, string(data), v.desc)
+		}
+	}
+}
+
+func TestCreateHostKeyCallbackFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "known_hosts")
+	second := filepath.Join(dir, "known_hosts2")
+
+	remote := &net.TCPAddr{IP: net.ParseIP("192.168.100.1"), Port: 22}
+	key := newTestHostKey(t)
+	assert.NoError(t, os.WriteFile(second, []byte(knownhosts.Line([]string{"web01"}, key)+"\n"), 0600))
+
+	r := &Run{ServerList: []string{"web01", "web02"}}
+	callback := r.createHostKeyCallback("web01", conf.ServerConfig{StrictHostKeyChecking: "accept-new", KnownHostsFiles: []string{first, second}})
+
+	// known in the second file
+	assert.NoError(t, callback("web01:22", remote, key))
+	assert.False(t, common.IsExist(first))
+
+	// new keys are appended to the first file in parallel, and verified after that
+	keys := map[string]ssh.PublicKey{}
+	for i := 0; i < 10; i++ {
+		keys[fmt.Sprintf("web%02d:22", i+10)] = newTestHostKey(t)
+	}
+
+	wg := new(sync.WaitGroup)
+	for hostname, k := range keys {
+		wg.Add(1)
+		go func(hostname string, k ssh.PublicKey) {
+			defer wg.Done()
+			assert.NoError(t, callback(hostname, remote, k), hostname)
+		}(hostname, k)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(first)
+	assert.NoError(t, err)
+	assert.Equal(t, len(keys), len(strings.Split(strings.TrimSpace(string(data)), "\n")))
+
+	for hostname, k := range keys {
+		assert.NoError(t, checkKnownHosts([]string{first, second}, hostname, remote, k), hostname)
+	}
+}
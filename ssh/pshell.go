@@ -0,0 +1,351 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/blacknon/go-sshlib"
+	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/output"
+	"github.com/c-bata/go-prompt"
+)
+
+var (
+	// pshell default prompt.
+	defaultPShellPrompt  = "[${COUNT}] <<< "
+	defaultPShellOPrompt = "[${SERVER}][${COUNT}] > "
+
+	// pshell default history file.
+	defaultPShellHistoryFile = "~/.lssh_history"
+)
+
+// pShell is parallel shell(pshell) struct.
+// Send the input line to all connected servers, and print the output with OPROMPT.
+type pShell struct {
+	// shell config ([shell] in config file)
+	Config conf.ShellConfig
+
+	// prompt templates
+	Prompt  string
+	OPrompt string
+
+	// history file path
+	HistoryFile string
+
+	// command count. ${COUNT}
+	Count int
+
+	// Selected Server list
+	ServerList []string
+
+	// Connected servers
+	Connects []*psConnect
+
+	// enable/disable print header
+	EnableHeader  bool
+	DisableHeader bool
+
+	// remote command list for completion
+	CmdComplete []prompt.Suggest
+	cmdMutex    *sync.Mutex
+}
+
+// psConnect is connection of each server in pshell.
+type psConnect struct {
+	Name   string
+	Output *output.Output
+	*sshlib.Connect
+}
+
+// pshell start parallel shell.
+func (r *Run) pshell() (err error) {
+	shellConf := r.Conf.Shell
+
+	ps := &pShell{
+		Config:        shellConf,
+		Prompt:        shellConf.Prompt,
+		OPrompt:       shellConf.OPrompt,
+		HistoryFile:   shellConf.HistoryFile,
+		Count:         0,
+		ServerList:    r.ServerList,
+		EnableHeader:  r.EnableHeader,
+		DisableHeader: r.DisableHeader,
+		cmdMutex:      new(sync.Mutex),
+	}
+
+	if ps.Prompt == "" {
+		ps.Prompt = defaultPShellPrompt
+	}
+
+	if ps.OPrompt == "" {
+		ps.OPrompt = defaultPShellOPrompt
+	}
+
+	if ps.HistoryFile == "" {
+		ps.HistoryFile = defaultPShellHistoryFile
+	}
+
+	// print header
+	r.PrintSelectServer()
+
+	// connect servers
+	ps.Connects = r.createPShellConnects()
+	if len(ps.Connects) == 0 {
+		return fmt.Errorf("Error: No server to connect.")
+	}
+
+	// run pre local command
+	if shellConf.PreCmd != "" {
+		execLocalCommand(shellConf.PreCmd)
+	}
+
+	// defer run post local command
+	if shellConf.PostCmd != "" {
+		defer execLocalCommand(shellConf.PostCmd)
+	}
+
+	// get remote command list.
+	// pass a copy of ps.Connects, because it is updated by checkKeepalive while running.
+	go ps.getRemoteCmdComplete(append([]*psConnect{}, ps.Connects...))
+
+	// set title
+	title := shellConf.Title
+	if title == "" {
+		title = "lssh"
+	}
+
+	// create go-prompt
+	p := prompt.New(
+		// Executor
+		ps.Executor,
+		// Completer
+		ps.Completer,
+		// title
+		prompt.OptionTitle(title),
+		// prompt
+		prompt.OptionLivePrefix(ps.CreatePrompt),
+		// history
+		prompt.OptionHistory(ps.GetHistory()),
+		//
+		prompt.OptionInputTextColor(prompt.Green),
+		//
+		prompt.OptionPrefixTextColor(prompt.Blue),
+		// Keybind
+		// Alt+Backspace
+		prompt.OptionAddASCIICodeBind(prompt.ASCIICodeBind{
+			ASCIICode: []byte{0x1b, 0x7f},
+			Fn:        prompt.DeleteWord,
+		}),
+		// Opt+LeftArrow
+		prompt.OptionAddASCIICodeBind(prompt.ASCIICodeBind{
+			ASCIICode: []byte{0x1b, 0x62},
+			Fn:        prompt.GoLeftWord,
+		}),
+		// Opt+RightArrow
+		prompt.OptionAddASCIICodeBind(prompt.ASCIICodeBind{
+			ASCIICode: []byte{0x1b, 0x66},
+			Fn:        prompt.GoRightWord,
+		}),
+		// exit checker
+		prompt.OptionSetExitCheckerOnInput(ps.exitChecker),
+	)
+
+	// start go-prompt
+	p.Run()
+
+	return
+}
+
+// createPShellConnects connect to r.ServerList in parallel, and return connected list.
+func (r *Run) createPShellConnects() (connects []*psConnect) {
+	ch := make(chan bool)
+	m := new(sync.Mutex)
+
+	// max number of servers connecting at the same time
+	sem := make(chan struct{}, r.getForks())
+
+	for _, s := range r.ServerList {
+		server := s
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem; ch <- true }()
+
+			// check count AuthMethod
+			if len(r.serverAuthMethodMap[server]) == 0 {
+				fmt.Fprintf(os.Stderr, "Error: %s is No AuthMethod.\n", server)
+				return
+			}
+
+			// Create sshlib.Connect
+			conn, err := r.CreateSshConnect(server)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %s:%s\n", server, err)
+				return
+			}
+
+			m.Lock()
+			connects = append(connects, &psConnect{Name: server, Connect: conn})
+			m.Unlock()
+		}()
+	}
+
+	// wait
+	for i := 0; i < len(r.ServerList); i++ {
+		<-ch
+	}
+
+	// sort by r.ServerList order
+	sorted := []*psConnect{}
+	for _, server := range r.ServerList {
+		for _, c := range connects {
+			if c.Name == server {
+				sorted = append(sorted, c)
+			}
+		}
+	}
+
+	// create Output
+	for _, c := range sorted {
+		c.Output = &output.Output{
+			Templete:      defaultPShellOPrompt,
+			ServerList:    r.ServerList,
+			Conf:          r.Conf.Server[c.Name],
+			EnableHeader:  r.EnableHeader,
+			DisableHeader: r.DisableHeader,
+			AutoColor:     true,
+		}
+		if r.Conf.Shell.OPrompt != "" {
+			c.Output.Templete = r.Conf.Shell.OPrompt
+		}
+		c.Output.Create(c.Name)
+	}
+
+	return sorted
+}
+
+// CreatePrompt return prompt string. Used in `prompt.OptionLivePrefix`.
+//
+// Template variable value.
+//   - ${COUNT}    ... Count value(int)
+//   - ${HOSTNAME} ... Local hostname
+//   - ${USER}     ... Local user name
+//   - ${PWD}      ... Local current directory
+func (ps *pShell) CreatePrompt() (p string, result bool) {
+	p = ps.Prompt
+
+	p = strings.Replace(p, "${COUNT}", strconv.Itoa(ps.Count), -1)
+
+	if strings.Contains(p, "${HOSTNAME}") {
+		hostname, _ := os.Hostname()
+		p = strings.Replace(p, "${HOSTNAME}", hostname, -1)
+	}
+
+	if strings.Contains(p, "${USER}") {
+		usr, _ := user.Current()
+		p = strings.Replace(p, "${USER}", usr.Username, -1)
+	}
+
+	if strings.Contains(p, "${PWD}") {
+		pwd, _ := os.Getwd()
+		p = strings.Replace(p, "${PWD}", pwd, -1)
+	}
+
+	return p, true
+}
+
+// GetHistory return the command list in history file.
+func (ps *pShell) GetHistory() (history []string) {
+	path := getPShellHistoryPath(ps.HistoryFile)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := sc.Text()
+		if strings.TrimSpace(line) != "" {
+			history = append(history, line)
+		}
+	}
+
+	return
+}
+
+// PutHistory append the command to history file.
+func (ps *pShell) PutHistory(command string) (err error) {
+	path := getPShellHistoryPath(ps.HistoryFile)
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintln(f, command)
+
+	return
+}
+
+// exitChecker return true if all connections are disconnected or if the `exit` command is entered.
+// This function used in `prompt.OptionSetExitCheckerOnInput`.
+func (ps *pShell) exitChecker(in string, breakline bool) bool {
+	if !breakline {
+		return false
+	}
+
+	switch strings.TrimSpace(in) {
+	case "exit", "quit", "bye":
+		return true
+	}
+
+	if len(ps.Connects) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: No valid connections\n")
+		return true
+	}
+
+	return false
+}
+
+// checkKeepalive remove disconnected servers from ps.Connects.
+func (ps *pShell) checkKeepalive() {
+	connects := []*psConnect{}
+	for _, c := range ps.Connects {
+		err := c.CheckClientAlive()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Exit Connect %s, Error: %s\n", c.Name, err)
+			c.Client.Close()
+			continue
+		}
+
+		connects = append(connects, c)
+	}
+
+	ps.Connects = connects
+}
+
+// getPShellHistoryPath return history file full path.
+func getPShellHistoryPath(path string) string {
+	usr, _ := user.Current()
+	if strings.HasPrefix(path, "~") {
+		path = strings.Replace(path, "~", usr.HomeDir, 1)
+	}
+
+	if common.IsExist(path) {
+		path = common.GetFullPath(path)
+	}
+
+	return path
+}
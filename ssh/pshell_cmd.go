@@ -0,0 +1,269 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the command execution used by pshell.
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Executor is pshell function. run the input line.
+func (ps *pShell) Executor(line string) {
+	// trim space
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return
+	}
+
+	// put history
+	ps.PutHistory(line)
+
+	// expand alias
+	pipeline := splitPipeLine(line)
+	for i, c := range pipeline {
+		pipeline[i] = ps.expandAlias(c)
+	}
+
+	// built-in command
+	fields := strings.Fields(pipeline[0])
+	if len(fields) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: syntax error near unexpected token `|`\n")
+		return
+	}
+
+	switch fields[0] {
+	case "exit", "quit", "bye":
+		return
+
+	case "history":
+		for i, h := range ps.GetHistory() {
+			fmt.Printf("%4d  %s\n", i+1, h)
+		}
+		return
+	}
+
+	// check connections
+	ps.checkKeepalive()
+	if len(ps.Connects) == 0 {
+		return
+	}
+
+	// split remote and local(outexec) command
+	remoteCmd, localCmd := ps.splitOutexec(pipeline)
+
+	// run
+	switch {
+	case remoteCmd == "":
+		execLocalPipeCommand(localCmd, nil)
+
+	case localCmd == "":
+		ps.run(remoteCmd, nil)
+
+	default:
+		ps.runWithOutexec(remoteCmd, localCmd)
+	}
+
+	ps.Count += 1
+}
+
+// expandAlias replace the first word of command with the alias command.
+func (ps *pShell) expandAlias(command string) string {
+	command = strings.TrimSpace(command)
+	fields := strings.SplitN(command, " ", 2)
+
+	alias, ok := ps.Config.Alias[fields[0]]
+	if !ok || alias.Command == "" {
+		return command
+	}
+
+	fields[0] = alias.Command
+	return strings.Join(fields, " ")
+}
+
+// splitOutexec split pipeline into the remote command and local command.
+// The first command defined in outexecs, and the commands after it are run locally.
+func (ps *pShell) splitOutexec(pipeline []string) (remoteCmd, localCmd string) {
+	index := len(pipeline)
+	for i, c := range pipeline {
+		fields := strings.SplitN(c, " ", 2)
+		if _, ok := ps.Config.OutexecCmdConfigs[fields[0]]; ok {
+			index = i
+			break
+		}
+	}
+
+	// replace outexec name to path
+	local := []string{}
+	for _, c := range pipeline[index:] {
+		fields := strings.SplitN(c, " ", 2)
+		if outexec, ok := ps.Config.OutexecCmdConfigs[fields[0]]; ok && outexec.Path != "" {
+			fields[0] = outexec.Path
+		}
+		local = append(local, strings.Join(fields, " "))
+	}
+
+	remoteCmd = strings.Join(pipeline[:index], " | ")
+	localCmd = strings.Join(local, " | ")
+
+	return
+}
+
+// runWithOutexec run command at remote servers, and send the output to local command.
+func (ps *pShell) runWithOutexec(remoteCmd, localCmd string) {
+	cmd := exec.Command("sh", "-c", localCmd)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return
+	}
+
+	err = cmd.Start()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		return
+	}
+
+	ps.run(remoteCmd, stdin)
+
+	stdin.Close()
+	cmd.Wait()
+}
+
+// run command at all connected servers in parallel.
+// If w is not nil, the output is written to w instead of stdout.
+func (ps *pShell) run(command string, w io.Writer) {
+	sessions := map[string]*ssh.Session{}
+	sm := new(sync.Mutex)
+
+	// Ctrl+C send SIGINT to remote command
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	defer signal.Stop(sig)
+
+	finished := make(chan bool)
+	go func() {
+		select {
+		case <-sig:
+			sm.Lock()
+			for _, s := range sessions {
+				s.Signal(ssh.SIGINT)
+				s.Close()
+			}
+			sm.Unlock()
+		case <-finished:
+		}
+	}()
+
+	wg := new(sync.WaitGroup)
+	for _, conn := range ps.Connects {
+		c := conn
+
+		session, err := c.CreateSession()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s:%s\n", c.Name, err)
+			continue
+		}
+
+		sm.Lock()
+		sessions[c.Name] = session
+		sm.Unlock()
+
+		// set output
+		c.Output.Count = ps.Count
+		c.Output.Writer = w
+
+		stdout, _ := session.StdoutPipe()
+		stderr, _ := session.StderrPipe()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			pwg := new(sync.WaitGroup)
+			pwg.Add(2)
+			go func() { c.Output.Printer(io.NopCloser(stdout)); pwg.Done() }()
+			go func() { c.Output.Printer(io.NopCloser(stderr)); pwg.Done() }()
+
+			session.Run(command)
+			pwg.Wait()
+			session.Close()
+		}()
+	}
+
+	wg.Wait()
+	close(finished)
+}
+
+// execLocalPipeCommand run the local command, with stdin.
+func execLocalPipeCommand(command string, stdin io.Reader) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdin = stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+	}
+}
+
+// splitPipeLine split the command line with `|`.
+// `|` in quotes, escaped `\|` and `||` are not split.
+func splitPipeLine(line string) (pipeline []string) {
+	var current strings.Builder
+	var quote rune
+	escaped := false
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+
+		switch {
+		case escaped:
+			escaped = false
+
+		case c == '\\' && quote != '\'':
+			escaped = true
+
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+
+		case c == '\'' || c == '"':
+			quote = c
+
+		case c == '|':
+			// `||`
+			if i+1 < len(runes) && runes[i+1] == '|' {
+				current.WriteString("||")
+				i++
+				continue
+			}
+
+			pipeline = append(pipeline, strings.TrimSpace(current.String()))
+			current.Reset()
+			continue
+		}
+
+		current.WriteRune(c)
+	}
+
+	pipeline = append(pipeline, strings.TrimSpace(current.String()))
+
+	return
+}
@@ -0,0 +1,99 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/c-bata/go-prompt"
+)
+
+// Completer is pshell function. return the suggest of command.
+func (ps *pShell) Completer(t prompt.Document) []prompt.Suggest {
+	// Get cursor left
+	left := t.CurrentLineBeforeCursor()
+
+	// complete only the first word of each command in pipeline
+	pipeline := splitPipeLine(left)
+	current := strings.TrimLeft(pipeline[len(pipeline)-1], " ")
+	if strings.Contains(current, " ") || current == "" {
+		return []prompt.Suggest{}
+	}
+
+	suggest := []prompt.Suggest{
+		{Text: "exit", Description: "exit lssh shell"},
+		{Text: "quit", Description: "exit lssh shell"},
+		{Text: "history", Description: "show history"},
+	}
+
+	// alias
+	for name, alias := range ps.Config.Alias {
+		suggest = append(suggest, prompt.Suggest{Text: name, Description: "alias: " + alias.Command})
+	}
+
+	// outexec
+	for name, outexec := range ps.Config.OutexecCmdConfigs {
+		suggest = append(suggest, prompt.Suggest{Text: name, Description: "local command: " + outexec.Path})
+	}
+
+	sort.SliceStable(suggest, func(i, j int) bool { return suggest[i].Text < suggest[j].Text })
+
+	// remote command
+	ps.cmdMutex.Lock()
+	suggest = append(suggest, ps.CmdComplete...)
+	ps.cmdMutex.Unlock()
+
+	return prompt.FilterHasPrefix(suggest, t.GetWordBeforeCursor(), false)
+}
+
+// getRemoteCmdComplete set the command list of connects to ps.CmdComplete.
+// If the connection is closed by checkKeepalive, the server is skipped.
+func (ps *pShell) getRemoteCmdComplete(connects []*psConnect) {
+	command := "bash -c 'compgen -c' 2>/dev/null"
+
+	m := map[string][]string{}
+	for _, c := range connects {
+		session, err := c.CreateSession()
+		if err != nil {
+			continue
+		}
+
+		data, err := session.Output(command)
+		session.Close()
+		if err != nil {
+			continue
+		}
+
+		for _, cmd := range strings.Fields(string(data)) {
+			if !contains(m[cmd], c.Name) {
+				m[cmd] = append(m[cmd], c.Name)
+			}
+		}
+	}
+
+	suggest := []prompt.Suggest{}
+	for cmd, servers := range m {
+		suggest = append(suggest, prompt.Suggest{
+			Text:        cmd,
+			Description: "remote command. from:" + strings.Join(servers, ","),
+		})
+	}
+
+	sort.SliceStable(suggest, func(i, j int) bool { return suggest[i].Text < suggest[j].Text })
+
+	ps.cmdMutex.Lock()
+	ps.CmdComplete = suggest
+	ps.cmdMutex.Unlock()
+}
+
+func contains(s []string, e string) bool {
+	for _, v := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+package ssh
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+
+	"github.com/blacknon/lssh/conf"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePrompt(t *testing.T) {
+	hostname, _ := os.Hostname()
+	usr, _ := user.Current()
+	pwd, _ := os.Getwd()
+
+	type TestData struct {
+		desc   string
+		prompt string
+		expect string
+	}
+	tds := []TestData{
+		{desc: "Default", prompt: defaultPShellPrompt, expect: "[3] <<< "},
+		{desc: "No variable", prompt: "> ", expect: "> "},
+		{desc: "All variables", prompt: "${USER}@${HOSTNAME}:${PWD}[${COUNT}]${COUNT}", expect: usr.Username + "@" + hostname + ":" + pwd + "[3]3"},
+	}
+	for _, v := range tds {
+		ps := &pShell{Prompt: v.prompt, Count: 3}
+		got, ok := ps.CreatePrompt()
+		assert.True(t, ok, v.desc)
+		assert.Equal(t, v.expect, got, v.desc)
+	}
+}
+
+func TestPShellHistory(t *testing.T) {
+	ps := &pShell{HistoryFile: filepath.Join(t.TempDir(), "history")}
+
+	// not exist
+	assert.Empty(t, ps.GetHistory())
+
+	for _, command := range []string{"hostname", "", "uname -a | grep Linux"} {
+		assert.NoError(t, ps.PutHistory(command))
+	}
+
+	// empty lines are skipped
+	assert.Equal(t, []string{"hostname", "uname -a | grep Linux"}, ps.GetHistory())
+
+	// not writable
+	ps.HistoryFile = filepath.Join(t.TempDir(), "not_exist", "history")
+	assert.Error(t, ps.PutHistory("hostname"))
+}
+
+func TestGetPShellHistoryPath(t *testing.T) {
+	usr, _ := user.Current()
+
+	assert.Equal(t, filepath.Join(usr.HomeDir, ".lssh_history"), getPShellHistoryPath(defaultPShellHistoryFile))
+	assert.Equal(t, "/not_exist/history", getPShellHistoryPath("/not_exist/history"))
+}
+
+func TestExitChecker(t *testing.T) {
+	type TestData struct {
+		desc      string
+		in        string
+		breakline bool
+		connects  []*psConnect
+		expect    bool
+	}
+	connects := []*psConnect{{Name: "server"}}
+	tds := []TestData{
+		{desc: "exit", in: "exit", breakline: true, connects: connects, expect: true},
+		{desc: "quit with spaces", in: "  quit ", breakline: true, connects: connects, expect: true},
+		{desc: "bye", in: "bye", breakline: true, connects: connects, expect: true},
+		{desc: "exit without breakline", in: "exit", breakline: false, connects: connects, expect: false},
+		{desc: "command", in: "exit_status", breakline: true, connects: connects, expect: false},
+		{desc: "no connection", in: "hostname", breakline: true, connects: nil, expect: true},
+	}
+	for _, v := range tds {
+		ps := &pShell{Connects: v.connects}
+		assert.Equal(t, v.expect, ps.exitChecker(v.in, v.breakline), v.desc)
+	}
+}
+
+func TestExpandAlias(t *testing.T) {
+	ps := &pShell{
+		Config: conf.ShellConfig{
+			Alias: map[string]conf.ShellAliasConfig{
+				"ll":    {Command: "ls -l"},
+				"empty": {Command: ""},
+			},
+		},
+	}
+
+	type TestData struct {
+		desc    string
+		command string
+		expect  string
+	}
+	tds := []TestData{
+		{desc: "Alias", command: "ll", expect: "ls -l"},
+		{desc: "Alias with args", command: " ll /tmp /var ", expect: "ls -l /tmp /var"},
+		{desc: "Alias only first word", command: "echo ll", expect: "echo ll"},
+		{desc: "Prefix is not alias", command: "lll", expect: "lll"},
+		{desc: "Empty alias", command: "empty arg", expect: "empty arg"},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.expect, ps.expandAlias(v.command), v.desc)
+	}
+}
+
+func TestSplitOutexec(t *testing.T) {
+	ps := &pShell{
+		Config: conf.ShellConfig{
+			OutexecCmdConfigs: map[string]conf.ShellOutexecCmdConfig{
+				"lgrep": {Path: "grep"},
+				"lsort": {},
+			},
+		},
+	}
+
+	type TestData struct {
+		desc         string
+		pipeline     []string
+		expectRemote string
+		expectLocal  string
+	}
+	tds := []TestData{
+		{desc: "Remote only", pipeline: []string{"ps -ef", "grep sshd"}, expectRemote: "ps -ef | grep sshd", expectLocal: ""},
+		{desc: "Outexec", pipeline: []string{"ps -ef", "lgrep sshd", "wc -l"}, expectRemote: "ps -ef", expectLocal: "grep sshd | wc -l"},
+		{desc: "Outexec without path", pipeline: []string{"ps -ef", "lsort"}, expectRemote: "ps -ef", expectLocal: "lsort"},
+	}
+	for _, v := range tds {
+		remote, local := ps.splitOutexec(v.pipeline)
+		assert.Equal(t, v.expectRemote, remote, v.desc)
+		assert.Equal(t, v.expectLocal, local, v.desc)
+	}
+}
+
+func TestSplitPipeLine(t *testing.T) {
+	type TestData struct {
+		desc   string
+		line   string
+		expect []string
+	}
+	tds := []TestData{
+		{desc: "No pipe", line: "hostname", expect: []string{"hostname"}},
+		{desc: "Pipe", line: "ps -ef | grep sshd |wc -l", expect: []string{"ps -ef", "grep sshd", "wc -l"}},
+		{desc: "Quoted", line: `echo 'a|b' "c|d" | cat`, expect: []string{`echo 'a|b' "c|d"`, "cat"}},
+		{desc: "Escaped", line: `echo a\|b | cat`, expect: []string{`echo a\|b`, "cat"}},
+		{desc: "Or", line: "test -f a || echo no | cat", expect: []string{"test -f a || echo no", "cat"}},
+	}
+	for _, v := range tds {
+		assert.Equal(t, v.expect, splitPipeLine(v.line), v.desc)
+	}
+}
@@ -0,0 +1,304 @@
+// Copyright (c) 2024 Blacknon. All rights reserved.
+// Use of this source code is governed by an MIT license
+// that can be found in the LICENSE file.
+
+// This file describes the code of the automatic reconnect (-a, --autoconnect).
+
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	nfs "github.com/blacknon/go-nfs-sshlib"
+	nfshelper "github.com/blacknon/go-nfs-sshlib/helpers"
+	"github.com/blacknon/go-sshlib"
+	"github.com/blacknon/lssh/conf"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// default retry count of auto reconnect (-a option).
+	DefaultAutoReconnectMax = 3
+
+	// reconnect backoff. The wait time is doubled each time, up to max.
+	reconnectBackoffMin = 1 * time.Second
+	reconnectBackoffMax = 60 * time.Second
+)
+
+// reconnectConn is ssh.Conn, that can switch the underlying connection.
+// The ssh.Client created from reconnectConn keeps working after reconnect,
+// so the local side port forwarding does not need to be restarted.
+type reconnectConn struct {
+	mu   sync.RWMutex
+	conn ssh.Conn
+	done chan struct{}
+	once sync.Once
+}
+
+// newReconnectClient return *ssh.Client, that uses the switchable connection of client.
+func newReconnectClient(client *ssh.Client) (*ssh.Client, *reconnectConn) {
+	rc := &reconnectConn{conn: client, done: make(chan struct{})}
+
+	// channel open and global request are received by the original client.
+	chans := make(chan ssh.NewChannel)
+	reqs := make(chan *ssh.Request)
+	close(chans)
+	close(reqs)
+
+	return ssh.NewClient(rc, chans, reqs), rc
+}
+
+// set switch the underlying connection.
+func (rc *reconnectConn) set(conn ssh.Conn) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.conn = conn
+}
+
+// get return the underlying connection.
+func (rc *reconnectConn) get() ssh.Conn {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return rc.conn
+}
+
+func (rc *reconnectConn) User() string          { return rc.get().User() }
+func (rc *reconnectConn) SessionID() []byte     { return rc.get().SessionID() }
+func (rc *reconnectConn) ClientVersion() []byte { return rc.get().ClientVersion() }
+func (rc *reconnectConn) ServerVersion() []byte { return rc.get().ServerVersion() }
+func (rc *reconnectConn) RemoteAddr() net.Addr  { return rc.get().RemoteAddr() }
+func (rc *reconnectConn) LocalAddr() net.Addr   { return rc.get().LocalAddr() }
+
+func (rc *reconnectConn) SendRequest(name string, wantReply bool, payload []byte) (bool, []byte, error) {
+	return rc.get().SendRequest(name, wantReply, payload)
+}
+
+func (rc *reconnectConn) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	return rc.get().OpenChannel(name, data)
+}
+
+// Close close the underlying connection, and stop switching.
+func (rc *reconnectConn) Close() error {
+	rc.once.Do(func() { close(rc.done) })
+	return rc.get().Close()
+}
+
+// Wait blocks until Close is called. The underlying connection may be switched in the meantime.
+func (rc *reconnectConn) Wait() error {
+	<-rc.done
+	return nil
+}
+
+// portForward is the running port forwarding of a server.
+// It is used to re-establish the forwarding after reconnect.
+type portForward struct {
+	Config conf.ServerConfig
+
+	// local is sshlib.Connect for local side forwarding (L, D, d, M).
+	// Its ssh.Client is created by newReconnectClient.
+	local *sshlib.Connect
+	conn  *reconnectConn
+
+	// nfs forward listener
+	nfsListener net.Listener
+	nfsMutex    sync.Mutex
+}
+
+// startPortForward start all port forwarding in config, with connect.
+func (r *Run) startPortForward(connect *sshlib.Connect, config conf.ServerConfig) (pf *portForward) {
+	client, rc := newReconnectClient(connect.Client)
+
+	pf = &portForward{
+		Config: config,
+		local:  &sshlib.Connect{Client: client},
+		conn:   rc,
+	}
+
+	// Local Port Forwarding
+	for _, fw := range config.Forwards {
+		switch fw.Mode {
+		case "L", "":
+			err := pf.local.TCPLocalForward(fw.Local, fw.Remote)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+
+	// Dynamic Port Forwarding
+	if config.DynamicPortForward != "" {
+		go pf.local.TCPDynamicForward("localhost", config.DynamicPortForward)
+	}
+
+	// HTTP Dynamic Port Forwarding
+	if config.HTTPDynamicPortForward != "" {
+		go pf.local.HTTPDynamicForward("localhost", config.HTTPDynamicPortForward)
+	}
+
+	// NFS Dynamic Forwarding
+	pf.startNFSForward(connect)
+
+	// Remote side Port Forwarding
+	pf.startRemoteForward(connect)
+
+	return
+}
+
+// reconnect switch the port forwarding to the new connect.
+// Local side forwarding continues to listen, remote side forwarding is requested again.
+func (pf *portForward) reconnect(connect *sshlib.Connect) {
+	pf.conn.set(connect.Client)
+
+	// NFS Dynamic Forwarding use sftp client of old connection, so restart it.
+	pf.startNFSForward(connect)
+
+	// Remote side Port Forwarding
+	pf.startRemoteForward(connect)
+}
+
+// startRemoteForward start remote side port forwarding (R, reverse D, r, m).
+func (pf *portForward) startRemoteForward(connect *sshlib.Connect) {
+	config := pf.Config
+
+	// Remote Port Forwarding
+	for _, fw := range config.Forwards {
+		switch fw.Mode {
+		case "R":
+			err := connect.TCPRemoteForward(fw.Local, fw.Remote)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+
+	// Reverse Dynamic Port Forwarding
+	if config.ReverseDynamicPortForward != "" {
+		go connect.TCPReverseDynamicForward("localhost", config.ReverseDynamicPortForward)
+	}
+
+	// HTTP Reverse Dynamic Port Forwarding
+	if config.HTTPReverseDynamicPortForward != "" {
+		go connect.HTTPReverseDynamicForward("localhost", config.HTTPReverseDynamicPortForward)
+	}
+
+	// NFS Reverse Dynamic Forwarding
+	if config.NFSReverseDynamicForwardPort != "" && config.NFSReverseDynamicForwardPath != "" {
+		go connect.NFSReverseForward("localhost", config.NFSReverseDynamicForwardPort, config.NFSReverseDynamicForwardPath)
+	}
+}
+
+// startNFSForward start NFS dynamic forwarding with connect.
+// If NFS forwarding is already running, close its listener and restart it.
+func (pf *portForward) startNFSForward(connect *sshlib.Connect) {
+	port := pf.Config.NFSDynamicForwardPort
+	path := pf.Config.NFSDynamicForwardPath
+	if port == "" || path == "" {
+		return
+	}
+
+	pf.nfsMutex.Lock()
+	defer pf.nfsMutex.Unlock()
+
+	if pf.nfsListener != nil {
+		pf.nfsListener.Close()
+		pf.nfsListener = nil
+	}
+
+	client, err := sftp.NewClient(connect.Client)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "NFS Forward Error: %s\n", err)
+		return
+	}
+
+	// create abs path
+	homepoint, err := client.RealPath(".")
+	if err != nil {
+		client.Close()
+		fmt.Fprintf(os.Stderr, "NFS Forward Error: %s\n", err)
+		return
+	}
+	basepoint := getRemoteAbsPath(homepoint, path)
+
+	listener, err := net.Listen("tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		client.Close()
+		fmt.Fprintf(os.Stderr, "NFS Forward Error: %s\n", err)
+		return
+	}
+	pf.nfsListener = listener
+
+	handler := nfshelper.NewNullAuthHandler(sshlib.NewChangeSFTPFS(client, basepoint))
+	cacheHelper := nfshelper.NewCachingHandler(handler, 1024)
+
+	go func() {
+		nfs.Serve(listener, cacheHelper)
+		client.Close()
+	}()
+}
+
+// reconnect create the connection of server again, with backoff.
+// The proxy route is also connected again in r.CreateSshConnect.
+// The old connection (with its proxy route) has to be closed by r.closeSshConnect before.
+// Retry up to r.AutoReconnectMax times (0 is unlimited).
+func (r *Run) reconnect(server string) (connect *sshlib.Connect, err error) {
+	wait := reconnectBackoffMin
+
+	max := "unlimited"
+	if r.AutoReconnectMax > 0 {
+		max = strconv.Itoa(r.AutoReconnectMax)
+	}
+
+	for i := 1; r.AutoReconnectMax == 0 || i <= r.AutoReconnectMax; i++ {
+		fmt.Fprintf(os.Stderr, "Reconnect     :%s (%d/%s) after %s\n", server, i, max, wait)
+		time.Sleep(wait)
+
+		connect, err = r.CreateSshConnect(server)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "Reconnect     :%s connected\n", server)
+			return
+		}
+
+		fmt.Fprintf(os.Stderr, "Reconnect Error: %s\n", err)
+
+		wait *= 2
+		if wait > reconnectBackoffMax {
+			wait = reconnectBackoffMax
+		}
+	}
+
+	err = fmt.Errorf("Error: reconnect to %s failed %s times, last error: %s", server, max, err)
+	return
+}
+
+// isDisconnected return true if the shell exited because the connection was lost.
+func isDisconnected(connect *sshlib.Connect, err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return false
+	}
+
+	return connect.CheckClientAlive() != nil
+}
+
+// getRemoteAbsPath return the absolute path on remote server.
+// `~` is replaced with wdpath.
+func getRemoteAbsPath(wdpath, path string) (result string) {
+	result = strings.Replace(path, "~", wdpath, 1)
+	if !strings.HasPrefix(result, "/") {
+		result = wdpath + "/" + result
+	}
+
+	return result
+}
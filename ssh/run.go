@@ -5,15 +5,16 @@
 package ssh
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"os/exec"
 	"runtime"
 	"strings"
+	"sync"
 
-	"github.com/blacknon/lssh/common"
 	"github.com/blacknon/lssh/conf"
+	"github.com/blacknon/lssh/history"
 	"github.com/sevlyar/go-daemon"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
@@ -21,11 +22,6 @@ import (
 
 // TOOD(blacknon): なんかProxyのポートが表示おかしいので、修正する(v0.7.0)
 
-// TODO(blacknon): 自動再接続機能の追加(v1.0.0)
-//     autosshのように、接続が切れた際に自動的に再接続を試みる動作をさせたい
-//     パラメータでの有効・無効指定が必要になる。
-//     → go-sshlib側で処理させる
-
 // TODO(blacknon): リバースでのsshfsの追加(v1.0.0以降？)
 //     lsshfs実装後になるか？ssh接続時に、指定したフォルダにローカルの内容をマウントさせて読み取らせる。
 //     うまくやれれば、ローカルのスクリプトなどをそのままマウントさせて実行させたりできるかもしれない。
@@ -46,6 +42,7 @@ type Run struct {
 	// Mode value in
 	//     - shell
 	//     - cmd
+	//     - pshell
 	Mode string
 
 	// tty use (-t option)
@@ -54,9 +51,26 @@ type Run struct {
 	// parallel connect (-p option)
 	IsParallel bool
 
+	// max number of servers connecting at the same time (--forks option).
+	// 0 is use config value, or unlimited.
+	Forks int
+
 	// not run (-N option)
 	IsNone bool
 
+	// background mode (-f option)
+	IsBackground bool
+
+	// pid file path of background mode (--pidfile option)
+	PidFile string
+
+	// auto reconnect (-a, --autoconnect option).
+	// reconnect when the connection of shell or -N is lost.
+	AutoReconnect bool
+
+	// max retry count of auto reconnect. 0 is unlimited.
+	AutoReconnectMax int
+
 	// x11 forwarding (-X option)
 	X11 bool
 
@@ -120,6 +134,28 @@ type Run struct {
 	EnableHeader  bool
 	DisableHeader bool
 
+	// output format of command mode (--output option).
+	// text|json (default: text)
+	OutputFormat string
+
+	// output directory of command mode (--output-dir option).
+	// <server>.out, <server>.err and <server>.rc are created in this directory.
+	OutputDir string
+
+	// aggregate mode of command mode (--aggregate option).
+	// The servers with identical output are grouped and printed once, like dshbak -c.
+	Aggregate bool
+
+	// print the output of groups as diff against majority (--diff option).
+	AggregateDiff bool
+
+	// exit policy of command mode (--exit-policy option).
+	// any|all|majority (default: any)
+	ExitPolicy string
+
+	// ExitCode is exit code of lssh, set by Start().
+	ExitCode int
+
 	// Agent is ssh-agent.
 	// In agent.Agent or agent.ExtendedAgent.
 	agent interface{}
@@ -135,6 +171,21 @@ type Run struct {
 	// Map of AuthMethod used by target server
 	serverAuthMethodMap map[string][]ssh.AuthMethod
 
+	// authSecrets is passphrases and PINs entered in the foreground, in background mode.
+	authSecrets map[AuthKey]string
+
+	// pidFile is the locked pid file of background process.
+	pidFile *daemon.LockFile
+
+	// proxyClients is the ssh clients of proxy route, by the client of target server.
+	// They are closed with the target server in closeSshConnect.
+	proxyClients map[*ssh.Client][]*ssh.Client
+	proxyMutex   sync.Mutex
+
+	// history records the connected servers to the connection history.
+	history     *history.Recorder
+	historyOnce sync.Once
+
 	// donedPKCS11 is　the value of panic measures (v0.6.2-).
 	// If error occurs and pkcs11 processing occurs more than once, the library will keep the token and Panic will occur.
 	// this value is so for countermeasures.
@@ -149,6 +200,7 @@ type AuthKey struct {
 	//   - key
 	//   - cert
 	//   - pkcs11
+	//   - vault (passphrase of vault, passed to the background process)
 	Type string
 
 	// auth type value:
@@ -173,6 +225,7 @@ const (
 	AUTHKEY_KEY      = "key"
 	AUTHKEY_CERT     = "cert"
 	AUTHKEY_PKCS11   = "pkcs11"
+	AUTHKEY_VAULT    = "vault"
 )
 
 // Start ssh connect
@@ -190,9 +243,37 @@ func (r *Run) Start() {
 		}
 	}
 
+	// background mode (-f) works with a single server.
+	if r.IsBackground && len(r.ServerList) != 1 {
+		fmt.Fprintf(os.Stderr, "Error: -f option works with a single server. %d servers are selected.\n", len(r.ServerList))
+		r.ExitCode = 1
+		return
+	}
+
+	// background mode (-f). initialize the background process.
+	if r.IsBackground && daemon.WasReborn() {
+		err = r.startBackgroundChild()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			r.ExitCode = 1
+			return
+		}
+		defer r.releaseBackground()
+	}
+
 	// create AuthMap
 	r.CreateAuthMethodMap()
 
+	// background mode (-f). authenticate in the foreground, and start the background process.
+	if r.IsBackground && !daemon.WasReborn() {
+		err = r.startBackgroundMode()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			r.ExitCode = 1
+		}
+		return
+	}
+
 	// connect
 	switch {
 	case len(r.ExecCmd) > 0 && r.Mode == "cmd":
@@ -203,12 +284,42 @@ func (r *Run) Start() {
 		// connect remote shell
 		err = r.shell()
 
+	case r.Mode == "pshell":
+		// start parallel shell
+		err = r.pshell()
+
 	default:
 		return
 	}
 
 	if err != nil {
+		// exit status of remote shell
+		var exitErr *ssh.ExitError
+		if errors.As(err, &exitErr) {
+			r.ExitCode = exitErr.ExitStatus()
+			return
+		}
+
 		fmt.Println(err)
+		r.ExitCode = 1
+	}
+}
+
+// recordHistory record the connected server with r.Mode to the connection history.
+// Each server is recorded once per run (reconnect and proxy are not recorded).
+// In background mode, it is recorded by the background process, not by the check connection.
+func (r *Run) recordHistory(server string) {
+	if r.IsBackground && !daemon.WasReborn() {
+		return
+	}
+
+	r.historyOnce.Do(func() {
+		r.history = history.NewRecorder(r.Mode)
+	})
+
+	err := r.history.Record(server)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record history: %s\n", err)
 	}
 }
 
@@ -302,9 +413,22 @@ func (r *Run) printNFSReverseDynamicForward(port, path string) {
 // printProxy is printout proxy route.
 // use ssh command run header. only use shell().
 func (r *Run) printProxy(server string) {
+	header, err := GetProxyRouteText(server, r.Conf)
+	if err != nil || header == "" {
+		return
+	}
+
+	// print header
+	fmt.Fprintf(os.Stderr, "Proxy         :%s\n", header)
+}
+
+// GetProxyRouteText returns the proxy route of server as text.
+// ex.) `localhost => [ssh://bastion:22] => server`
+// If server does not use proxy, it returns empty string.
+func GetProxyRouteText(server string, config conf.Config) (text string, err error) {
 	array := []string{}
 
-	proxyRoute, err := getProxyRoute(server, r.Conf)
+	proxyRoute, err := getProxyRoute(server, config)
 	if err != nil || len(proxyRoute) == 0 {
 		return
 	}
@@ -340,9 +464,8 @@ func (r *Run) printProxy(server string) {
 	// add target
 	array = append(array, targethost)
 
-	// print header
-	header := strings.Join(array, " => ")
-	fmt.Fprintf(os.Stderr, "Proxy         :%s\n", header)
+	text = strings.Join(array, " => ")
+	return
 }
 
 // setPortForwards is Add local/remote port forward to Run.PortForward
@@ -362,40 +485,9 @@ func (r *Run) setPortForwards(server string, config conf.ServerConfig) (c conf.S
 
 	// append port forwards from c, to r.PortForward
 	for _, f := range c.PortForwards {
-		var err error
-
-		// create forward
-		fw := new(conf.PortForward)
-
-		// split config forward settings
-		farray := strings.SplitN(f, ":", 2)
-
-		// check array count
-		if len(farray) == 1 {
-			fmt.Fprintf(os.Stderr, "port forward format is incorrect: %s: \"%s\"", server, f)
-			continue
-		}
-
-		//
-		mode := strings.ToLower(farray[0])
-		switch mode {
-		// local/remote port forward
-		case "local", "l":
-			fw.Mode = "L"
-			fw.Local, fw.Remote, err = common.ParseForwardPort(farray[1])
-
-		case "remote", "r":
-			fw.Mode = "R"
-			fw.Local, fw.Remote, err = common.ParseForwardPort(farray[1])
-
-		// other
-		default:
-			fmt.Fprintf(os.Stderr, "port forward format is incorrect: %s: \"%s\"", server, f)
-			continue
-		}
-
+		fw, err := conf.ParsePortForward(f)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "port forward format is incorrect: %s: \"%s\"", server, f)
+			fmt.Fprintf(os.Stderr, "%s: %s\n", server, err)
 			continue
 		}
 
@@ -414,25 +506,3 @@ func execLocalCommand(cmd string) {
 	out, _ := exec.Command("sh", "-c", cmd).CombinedOutput()
 	fmt.Printf(string(out))
 }
-
-// startBackgroundMode run deamon mode
-// not working... and not use... how this do ...?
-func startBackgroundMode() {
-	cntxt := &daemon.Context{}
-	d, err := cntxt.Reborn()
-	if err != nil {
-		log.Fatalln(err)
-	}
-
-	if d != nil {
-		return
-	}
-
-	defer func() {
-		if err := cntxt.Release(); err != nil {
-			log.Printf("error encountered while killing daemon: %v", err)
-		}
-	}()
-
-	return
-}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/blacknon/go-sshlib"
 	"github.com/blacknon/lssh/common"
+	"github.com/blacknon/lssh/conf"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -104,68 +105,13 @@ func (r *Run) shell() (err error) {
 		return
 	}
 
-	// Create session
-	session, err := connect.CreateSession()
-	if err != nil {
-		return
-	}
-
-	// ssh-agent
-	if config.SSHAgentUse {
-		connect.Agent = r.agent
-		connect.ForwardSshAgent(session)
-	}
-
-	// Local/Remote Port Forwarding
-	for _, fw := range config.Forwards {
-		// port forwarding
-		switch fw.Mode {
-		case "L", "":
-			err = connect.TCPLocalForward(fw.Local, fw.Remote)
-		case "R":
-			err = connect.TCPRemoteForward(fw.Local, fw.Remote)
-		}
-
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-		}
-	}
-
-	// Dynamic Port Forwarding
-	if config.DynamicPortForward != "" {
-		go connect.TCPDynamicForward("localhost", config.DynamicPortForward)
-	}
-
-	// Reverse Dynamic Port Forwarding
-	if config.ReverseDynamicPortForward != "" {
-		go connect.TCPReverseDynamicForward("localhost", config.ReverseDynamicPortForward)
-	}
-
-	// HTTP Dynamic Port Forwarding
-	if config.HTTPDynamicPortForward != "" {
-		go connect.HTTPDynamicForward("localhost", config.HTTPDynamicPortForward)
-	}
-
-	// HTTP Reverse Dynamic Port Forwarding
-	if config.HTTPReverseDynamicPortForward != "" {
-		go connect.HTTPReverseDynamicForward("localhost", config.HTTPReverseDynamicPortForward)
-	}
-
-	// NFS Dynamic Forwarding
-	if config.NFSDynamicForwardPort != "" && config.NFSDynamicForwardPath != "" {
-		go connect.NFSForward("localhost", config.NFSDynamicForwardPort, config.NFSDynamicForwardPath)
-	}
-
-	// NFS Reverse Dynamic Forwarding
-	if config.NFSReverseDynamicForwardPort != "" && config.NFSReverseDynamicForwardPath != "" {
-		go connect.NFSReverseForward("localhost", config.NFSReverseDynamicForwardPort, config.NFSReverseDynamicForwardPath)
-	}
+	// Port Forwarding
+	pf := r.startPortForward(connect, config)
 
 	// switch check Not-execute flag
-	// TODO(blacknon): Backgroundフラグを実装したら追加
 	switch {
 	case r.IsNone:
-		r.noneExecute(connect)
+		err = r.noneExecute(server, connect, pf)
 
 	default:
 		// run pre local command
@@ -178,28 +124,64 @@ func (r *Run) shell() (err error) {
 			defer execLocalCommand(config.PostCmd)
 		}
 
-		// if terminal log enable
-		logConf := r.Conf.Log
-		if logConf.Enable {
-			logPath := r.getLogPath(server)
+		for {
+			err = r.runShell(server, connect, config)
 
-			// Check logging with remove ANSI code flag.
-			if logConf.RemoveAnsiCode {
-				connect.SetLogWithRemoveAnsiCode(logPath, logConf.Timestamp)
-			} else {
-				connect.SetLog(logPath, logConf.Timestamp)
+			// auto reconnect
+			if !r.AutoReconnect || !isDisconnected(connect, err) {
+				break
 			}
+
+			fmt.Fprintf(os.Stderr, "Exit Connect, Error: %s\n", err)
+			r.closeSshConnect(connect)
+
+			connect, err = r.reconnect(server)
+			if err != nil {
+				return
+			}
+
+			pf.reconnect(connect)
 		}
+	}
+
+	return
+}
+
+// runShell create session, and connect to remote shell.
+func (r *Run) runShell(server string, connect *sshlib.Connect, config conf.ServerConfig) (err error) {
+	// Create session
+	session, err := connect.CreateSession()
+	if err != nil {
+		return
+	}
+
+	// ssh-agent
+	if config.SSHAgentUse {
+		connect.Agent = r.agent
+		connect.ForwardSshAgent(session)
+	}
 
-		// TODO(blacknon): local rc file add
-		if config.LocalRcUse == "yes" {
-			err = localrcShell(connect, session, config.LocalRcPath, config.LocalRcDecodeCmd, config.LocalRcCompress, config.LocalRcUncompressCmd)
+	// if terminal log enable
+	logConf := r.Conf.Log
+	if logConf.Enable {
+		logPath := r.getLogPath(server)
+
+		// Check logging with remove ANSI code flag.
+		if logConf.RemoveAnsiCode {
+			connect.SetLogWithRemoveAnsiCode(logPath, logConf.Timestamp)
 		} else {
-			// Connect shell
-			err = connect.Shell(session)
+			connect.SetLog(logPath, logConf.Timestamp)
 		}
 	}
 
+	// TODO(blacknon): local rc file add
+	if config.LocalRcUse == "yes" {
+		err = localrcShell(connect, session, config.LocalRcPath, config.LocalRcDecodeCmd, config.LocalRcCompress, config.LocalRcUncompressCmd)
+	} else {
+		// Connect shell
+		err = connect.Shell(session)
+	}
+
 	return
 }
 
@@ -243,7 +225,8 @@ func (r *Run) getLogDirPath(server string) (dir string, err error) {
 }
 
 // noneExecute is not execute command and shell.
-func (r *Run) noneExecute(con *sshlib.Connect) (err error) {
+// If auto reconnect is enabled, reconnect when the connection is lost.
+func (r *Run) noneExecute(server string, con *sshlib.Connect, pf *portForward) (err error) {
 loop:
 	for {
 		select {
@@ -254,10 +237,19 @@ loop:
 				// error
 				fmt.Fprintf(os.Stderr, "Exit Connect, Error: %s\n", err)
 
-				// close sftp client
-				con.Client.Close()
+				// close ssh client (with proxy route)
+				r.closeSshConnect(con)
+
+				if !r.AutoReconnect {
+					break loop
+				}
+
+				con, err = r.reconnect(server)
+				if err != nil {
+					break loop
+				}
 
-				break loop
+				pf.reconnect(con)
 			}
 
 			continue loop
@@ -304,7 +296,7 @@ func localrcShell(connect *sshlib.Connect, session *ssh.Session, localrcPath []s
 
 	}
 
-	connect.CmdShell(session, cmd)
+	err = connect.CmdShell(session, cmd)
 
 	return
 }